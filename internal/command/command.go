@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/110y/run"
 	"github.com/110y/servergroup"
+	"go.opentelemetry.io/otel"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/db/cloudrun"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/distributor/xds"
@@ -14,18 +16,30 @@ import (
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/event/broker/gopubsub"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/event/subscriber"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/flag/flag"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/admin"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/cloudevents"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/grpc"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/http"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/metrics"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/inventory"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/log/zap"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/worker/debouncer"
 	"github.com/kauche/cloud-run-service-router-xds/internal/driver/worker/ticker"
 	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
 )
 
+// tracerProviderShutdownTimeout is the timeout to export the remaining spans on shutdown.
+const tracerProviderShutdownTimeout = 5 * time.Second
+
 const (
 	exitCodeFailedToCreateLogger                    = 100
 	exitCodeFailedToCreateCloudRunClient            = 101
 	exitCodeFailedToSubscribeServicesRefreshedEvent = 102
 	exitCodeFailedToGetFlags                        = 103
 	exitCodeFailedToGetEnvironments                 = 104
+	exitCodeFailedToCreateMetrics                   = 105
+	exitCodeFailedToCreateTracerProvider            = 106
 	exitCodeServerAborted                           = 200
 )
 
@@ -34,7 +48,7 @@ func Run() {
 }
 
 func server(ctx context.Context) int {
-	logger, err := zap.NewLogger()
+	logger, verbosity, err := zap.NewLogger()
 	if err != nil {
 		_, ferr := fmt.Fprintf(os.Stderr, "failed to create a logger: %s", err)
 		if ferr != nil {
@@ -52,9 +66,32 @@ func server(ctx context.Context) int {
 		return exitCodeFailedToGetEnvironments
 	}
 
-	sc := xds.NewSnapshotCache(logger.WithName("snapshot_cache"))
+	if env.OTLPEndpoint != "" || env.OTLPTracesEndpoint != "" {
+		exporter, err := telemetry.NewOTLPExporter(ctx)
+		if err != nil {
+			commandLogger.Error(err, "failed to create an otlp exporter")
+			return exitCodeFailedToCreateTracerProvider
+		}
 
-	sd := xds.NewServiceDistributor(sc)
+		tp, err := telemetry.NewTracerProvider(ctx, exporter)
+		if err != nil {
+			commandLogger.Error(err, "failed to create a tracer provider")
+			return exitCodeFailedToCreateTracerProvider
+		}
+
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), tracerProviderShutdownTimeout)
+			defer cancel()
+
+			if err := tp.Shutdown(ctx); err != nil {
+				commandLogger.Error(err, "failed to shutdown the tracer provider")
+			}
+		}()
+
+		otel.SetTracerProvider(tp)
+	}
+
+	sc := xds.NewSnapshotCache(logger.WithName("snapshot_cache"))
 
 	sb := gopubsub.NewServiceEventBroker(logger.WithName("service_event_broker"))
 
@@ -64,7 +101,19 @@ func server(ctx context.Context) int {
 		return exitCodeFailedToGetFlags
 	}
 
-	sr, err := cloudrun.NewServiceRepository(ctx, flags.Project, flags.Location, env.CloudRunEmulatorHost)
+	verbosity.Set(flags.Verbosity)
+
+	inv := inventory.NewInventory()
+
+	m, err := telemetry.NewMetrics(inv.OpenStreamsByType)
+	if err != nil {
+		commandLogger.Error(err, "failed to create metrics")
+		return exitCodeFailedToCreateMetrics
+	}
+
+	sd := xds.NewServiceDistributor(sc, flags.EDS, flags.UpstreamCABundle, flags.ProxylessCertificateProvider, flags.DistributionConcurrency, m)
+
+	sr, err := cloudrun.NewServiceRepository(ctx, flags.Projects, flags.Locations, flags.HeaderPrefix, flags.ServiceSelector, env.CloudRunEmulatorHost, m, logger.WithName("service_repository"))
 	if err != nil {
 		commandLogger.Error(err, "failed to create a cloud run client")
 		return exitCodeFailedToCreateCloudRunClient
@@ -76,7 +125,11 @@ func server(ctx context.Context) int {
 
 	st := ticker.NewServiceRefreshTicker(uc, flags.SyncPeriod, logger.WithName("service_refresh_ticker"))
 
-	gs := grpc.NewServer(ctx, uc, sc, env.Port, logger.WithName("grpc_server"))
+	srd := debouncer.NewServiceRefreshDebouncer(uc, flags.RefreshDebounce, logger.WithName("service_refresh_debouncer"))
+
+	xs := grpc.NewXDSServer(ctx, uc, sc, sd, inv, m, flags.ClientCleanupGracePeriod, logger.WithName("grpc_server"))
+
+	gs := grpc.NewServer(xs, env.Port)
 
 	if err := sb.SubscribeServicesRefreshedEvent(ctx, ss.ServicesRefreshedEventHandler); err != nil {
 		commandLogger.Error(err, "failed to subscribe the service refreshed event")
@@ -89,6 +142,24 @@ func server(ctx context.Context) int {
 	sg.Add(gs)
 	sg.Add(sb)
 
+	if env.XDSHTTPPort != 0 {
+		sg.Add(http.NewServer(xs, env.XDSHTTPPort, logger.WithName("http_server")))
+	}
+
+	// NOTE: the ticker keeps refreshing services as a safety net in case that change notifications are lost.
+	if env.EventHTTPPort != 0 {
+		sg.Add(srd)
+		sg.Add(cloudevents.NewServer(srd, env.EventHTTPPort, logger.WithName("cloudevents_server")))
+	}
+
+	if env.AdminHTTPPort != 0 {
+		sg.Add(admin.NewServer(uc, inv, sc, env.AdminHTTPPort, logger.WithName("admin_server")))
+	}
+
+	if env.MetricsHTTPPort != 0 {
+		sg.Add(metrics.NewServer(m.Handler(), env.MetricsHTTPPort))
+	}
+
 	if err := sg.Start(ctx); err != nil {
 		commandLogger.Error(err, "the server has aborted")
 		return exitCodeServerAborted
@@ -7,9 +7,19 @@ import (
 )
 
 type ServiceDistributor interface {
-	DistributeServices(ctx context.Context, services []*entity.Service) error
+	DistributeServices(ctx context.Context, services []*entity.Service) (*entity.DistributionResult, error)
+	DistributeChangedServices(ctx context.Context, services []*entity.Service, diff *entity.ServiceDiff) (*entity.DistributionResult, error)
+	// DistributeServicesToFailedClients distributes the services to the clients to which the last distribution failed,
+	// so that they are retried even if the services have not changed.
+	DistributeServicesToFailedClients(ctx context.Context, services []*entity.Service) (*entity.DistributionResult, error)
 	DistributeServicesToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error
+	DistributeRoutesToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error
 	DistributeClustersToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error
+	DistributeEndpointsToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error
 	RegisterClient(ctx context.Context, client string, serviceNames []string) error
+	RegisterRoutesToClient(ctx context.Context, client string, serviceNames []string) error
 	RegisterClustersToClient(ctx context.Context, client string, serviceNames []string) error
+	RegisterEndpointsToClient(ctx context.Context, client string, clusterNames []string) error
+	RegisterClientAttributes(ctx context.Context, client *entity.Client) error
+	UnregisterClient(ctx context.Context, client string) error
 }
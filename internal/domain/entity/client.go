@@ -0,0 +1,15 @@
+package entity
+
+// Client is the client (e.g. an Envoy or a proxyless gRPC application) which receives resources from the distributor.
+type Client struct {
+	ID string
+
+	// ProxylessSecurity is true if the client is a proxyless gRPC client which has opted in to receive the xDS security settings.
+	ProxylessSecurity bool
+
+	// Envoy is true if the client is an Envoy proxy, which requires IP addresses as the endpoints of ClusterLoadAssignments.
+	Envoy bool
+
+	// Group is the group of clients (e.g. `staging`) to which the client belongs. Empty means that the client belongs to no group.
+	Group string
+}
@@ -0,0 +1,10 @@
+package entity
+
+// DistributionResult is the number of clients to which services are distributed, by the outcome.
+type DistributionResult struct {
+	Succeeded int
+	Failed    int
+
+	// Skipped are the clients to which services are not distributed since the distribution has been canceled.
+	Skipped int
+}
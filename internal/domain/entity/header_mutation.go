@@ -0,0 +1,26 @@
+package entity
+
+import "slices"
+
+// Header is an HTTP header with its value.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// HeaderMutation is the set of headers which are added to or removed from requests and responses of a route.
+// The headers to add overwrite the existing headers with the same name.
+type HeaderMutation struct {
+	RequestHeadersToAdd     []Header
+	RequestHeadersToRemove  []string
+	ResponseHeadersToAdd    []Header
+	ResponseHeadersToRemove []string
+}
+
+// Equal returns true if two header mutations have same headers in the same order.
+func (m HeaderMutation) Equal(other HeaderMutation) bool {
+	return slices.Equal(m.RequestHeadersToAdd, other.RequestHeadersToAdd) &&
+		slices.Equal(m.RequestHeadersToRemove, other.RequestHeadersToRemove) &&
+		slices.Equal(m.ResponseHeadersToAdd, other.ResponseHeadersToAdd) &&
+		slices.Equal(m.ResponseHeadersToRemove, other.ResponseHeadersToRemove)
+}
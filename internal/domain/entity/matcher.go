@@ -0,0 +1,38 @@
+package entity
+
+// MatcherSource is the part of a request which a Matcher inspects.
+type MatcherSource int
+
+const (
+	// MatcherSourceHeader matches against the value of the request header.
+	MatcherSourceHeader MatcherSource = iota
+	// MatcherSourceQueryParameter matches against the value of the query parameter.
+	MatcherSourceQueryParameter
+)
+
+// MatchKind is the way how a Matcher compares the value of a request with its Value.
+type MatchKind int
+
+const (
+	// MatchKindExact matches if the value is exactly same as the Matcher's Value.
+	MatchKindExact MatchKind = iota
+	// MatchKindPrefix matches if the value starts with the Matcher's Value.
+	MatchKindPrefix
+	// MatchKindSafeRegex matches if the value matches the RE2 regular expression of the Matcher's Value.
+	MatchKindSafeRegex
+	// MatchKindPresent matches if the header or the query parameter exists regardless of its value.
+	MatchKindPresent
+)
+
+// Matcher describes which requests are sent to a route.
+type Matcher struct {
+	Source MatcherSource
+
+	// Name is the name of the header or the query parameter.
+	Name string
+
+	Kind MatchKind
+
+	// Value is compared with the value of the header or the query parameter. It is ignored if the Kind is MatchKindPresent.
+	Value string
+}
@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+// RetryPolicy describes how failed requests to a route are retried.
+type RetryPolicy struct {
+	// RetryOn are the conditions (e.g. `unavailable`, `5xx`) under which requests are retried.
+	RetryOn []string
+
+	NumRetries uint32
+
+	// PerTryTimeout is the timeout of each attempt. Zero means that the timeout of the route is used.
+	PerTryTimeout time.Duration
+
+	// BaseInterval and MaxInterval configure the exponential backoff between retries. Zero means the default of the client.
+	BaseInterval time.Duration
+	MaxInterval  time.Duration
+
+	// RetriableStatusCodes are the HTTP status codes which are retried in addition to RetryOn.
+	RetriableStatusCodes []uint32
+}
+
+// Equal returns true if two retry policies have same fields with same values. Two nil policies are equal.
+func (p *RetryPolicy) Equal(other *RetryPolicy) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+
+	if !slices.Equal(p.RetryOn, other.RetryOn) {
+		return false
+	}
+
+	if p.NumRetries != other.NumRetries {
+		return false
+	}
+
+	if p.PerTryTimeout != other.PerTryTimeout {
+		return false
+	}
+
+	if p.BaseInterval != other.BaseInterval {
+		return false
+	}
+
+	if p.MaxInterval != other.MaxInterval {
+		return false
+	}
+
+	return slices.Equal(p.RetriableStatusCodes, other.RetriableStatusCodes)
+}
+
+// HedgePolicy describes how requests to a route are hedged.
+type HedgePolicy struct {
+	// InitialRequests is the number of requests which are sent initially. Zero means the default of the client.
+	InitialRequests uint32
+
+	// HedgeOnPerTryTimeout sends another request without canceling the original one when the per-try timeout exceeds.
+	HedgeOnPerTryTimeout bool
+}
+
+// Equal returns true if two hedge policies have same fields with same values. Two nil policies are equal.
+func (p *HedgePolicy) Equal(other *HedgePolicy) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+
+	if p.InitialRequests != other.InitialRequests {
+		return false
+	}
+
+	return p.HedgeOnPerTryTimeout == other.HedgeOnPerTryTimeout
+}
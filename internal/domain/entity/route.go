@@ -1,9 +1,40 @@
 package entity
 
+import (
+	"slices"
+	"time"
+)
+
 type Route struct {
 	Name    string
 	Host    string
 	Version string
+
+	// Endpoints are the hosts which serve this route, e.g. the deterministic and the regional URLs of the service.
+	Endpoints []string
+
+	// Matcher is the matcher of requests which are pinned to this route.
+	Matcher Matcher
+
+	// Timeout is the timeout of requests to this route. Zero means that the default timeout is used.
+	Timeout time.Duration
+
+	// RetryPolicy and HedgePolicy are nil if requests to this route are neither retried nor hedged.
+	RetryPolicy *RetryPolicy
+	HedgePolicy *HedgePolicy
+
+	// HeaderMutation is the headers which are added to or removed from requests to and responses from this route.
+	HeaderMutation HeaderMutation
+
+	// Weight is the percentage of the traffic which does not match any header-based route but is sent to this route.
+	// Zero means that the route receives only the header-matched traffic.
+	Weight uint32
+
+	// PathPrefix is the path prefix of the origin service's API which this route claims regardless of headers.
+	PathPrefix string
+
+	// GRPCMethods are the fully-qualified gRPC methods (e.g. `/pkg.Foo/Bar`) which this route claims regardless of headers.
+	GRPCMethods []string
 }
 
 // Equal returns true if two routes have same fields with same values.
@@ -24,5 +55,41 @@ func (r *Route) Equal(other *Route) bool {
 		return false
 	}
 
+	if !slices.Equal(r.Endpoints, other.Endpoints) {
+		return false
+	}
+
+	if r.Matcher != other.Matcher {
+		return false
+	}
+
+	if r.Timeout != other.Timeout {
+		return false
+	}
+
+	if !r.RetryPolicy.Equal(other.RetryPolicy) {
+		return false
+	}
+
+	if !r.HedgePolicy.Equal(other.HedgePolicy) {
+		return false
+	}
+
+	if !r.HeaderMutation.Equal(other.HeaderMutation) {
+		return false
+	}
+
+	if r.Weight != other.Weight {
+		return false
+	}
+
+	if r.PathPrefix != other.PathPrefix {
+		return false
+	}
+
+	if !slices.Equal(r.GRPCMethods, other.GRPCMethods) {
+		return false
+	}
+
 	return true
 }
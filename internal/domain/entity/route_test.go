@@ -1,6 +1,9 @@
 package entity
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestRouteEqual(t *testing.T) {
 	t.Parallel()
@@ -56,6 +59,175 @@ func TestRouteEqual(t *testing.T) {
 			},
 			want: false,
 		},
+		"should return false if two routes have the different Matcher": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				Matcher: Matcher{
+					Source: MatcherSourceHeader,
+					Name:   "x-test",
+					Kind:   MatchKindExact,
+					Value:  "test",
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				Matcher: Matcher{
+					Source: MatcherSourceHeader,
+					Name:   "x-test",
+					Kind:   MatchKindPrefix,
+					Value:  "test",
+				},
+			},
+			want: false,
+		},
+		"should return false if two routes have the different Timeout": {
+			route: &Route{
+				Name:    "test",
+				Host:    "test.example.com",
+				Timeout: 10 * time.Second,
+			},
+			other: &Route{
+				Name:    "test",
+				Host:    "test.example.com",
+				Timeout: 300 * time.Second,
+			},
+			want: false,
+		},
+		"should return false if two routes have the different RetryPolicy": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				RetryPolicy: &RetryPolicy{
+					RetryOn:    []string{"unavailable"},
+					NumRetries: 3,
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				RetryPolicy: &RetryPolicy{
+					RetryOn:    []string{"unavailable"},
+					NumRetries: 5,
+				},
+			},
+			want: false,
+		},
+		"should return false if only one of two routes has a RetryPolicy": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				RetryPolicy: &RetryPolicy{
+					RetryOn: []string{"unavailable"},
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+			},
+			want: false,
+		},
+		"should return false if two routes have the different HedgePolicy": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				HedgePolicy: &HedgePolicy{
+					HedgeOnPerTryTimeout: true,
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				HedgePolicy: &HedgePolicy{
+					HedgeOnPerTryTimeout: false,
+				},
+			},
+			want: false,
+		},
+		"should return false if only one of two routes has a HedgePolicy": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				HedgePolicy: &HedgePolicy{
+					InitialRequests: 2,
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+			},
+			want: false,
+		},
+		"should return false if two routes have the different Weight": {
+			route: &Route{
+				Name:   "test",
+				Host:   "test.example.com",
+				Weight: 10,
+			},
+			other: &Route{
+				Name:   "test",
+				Host:   "test.example.com",
+				Weight: 20,
+			},
+			want: false,
+		},
+		"should return false if two routes have the different PathPrefix": {
+			route: &Route{
+				Name:       "test",
+				Host:       "test.example.com",
+				PathPrefix: "/foo",
+			},
+			other: &Route{
+				Name:       "test",
+				Host:       "test.example.com",
+				PathPrefix: "/bar",
+			},
+			want: false,
+		},
+		"should return false if two routes have the different GRPCMethods": {
+			route: &Route{
+				Name:        "test",
+				Host:        "test.example.com",
+				GRPCMethods: []string{"/pkg.Foo/Bar"},
+			},
+			other: &Route{
+				Name:        "test",
+				Host:        "test.example.com",
+				GRPCMethods: []string{"/pkg.Foo/Bar", "/pkg.Foo/Baz"},
+			},
+			want: false,
+		},
+		"should return false if two routes have the different Endpoints": {
+			route: &Route{
+				Name:      "test",
+				Host:      "test.example.com",
+				Endpoints: []string{"test.example.com"},
+			},
+			other: &Route{
+				Name:      "test",
+				Host:      "test.example.com",
+				Endpoints: []string{"test-1.example.com", "test.example.com"},
+			},
+			want: false,
+		},
+		"should return false if two routes have the different HeaderMutation": {
+			route: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				HeaderMutation: HeaderMutation{
+					ResponseHeadersToAdd: []Header{{Name: "x-served-by", Value: "test"}},
+				},
+			},
+			other: &Route{
+				Name: "test",
+				Host: "test.example.com",
+				HeaderMutation: HeaderMutation{
+					ResponseHeadersToAdd: []Header{{Name: "x-served-by", Value: "test-1"}},
+				},
+			},
+			want: false,
+		},
 		"should return false if the route passed as the argument is nil": {
 			route: &Route{
 				Name: "test",
@@ -1,10 +1,23 @@
 package entity
 
+import "slices"
+
 type Service struct {
 	Name         string
 	Version      string
 	DefaultRoute *Route
 	Routes       map[string]*Route
+
+	// Aliases are the names, other than Name, with which clients can reach the service (e.g. `payments.internal` and `payments:443`).
+	Aliases []string
+
+	// VisibleTo are the groups of clients to which the service is distributed. Empty means that the service is distributed to all clients.
+	VisibleTo []string
+}
+
+// IsVisibleTo returns true if the service is distributed to the clients of the group.
+func (s *Service) IsVisibleTo(group string) bool {
+	return len(s.VisibleTo) == 0 || slices.Contains(s.VisibleTo, group)
 }
 
 // Equal returns true if two routes have same fields (including Routes) with same values except Version.
@@ -21,6 +34,14 @@ func (s *Service) Equal(other *Service) bool {
 		return false
 	}
 
+	if !slices.Equal(s.Aliases, other.Aliases) {
+		return false
+	}
+
+	if !slices.Equal(s.VisibleTo, other.VisibleTo) {
+		return false
+	}
+
 	if !s.DefaultRoute.Equal(other.DefaultRoute) {
 		return false
 	}
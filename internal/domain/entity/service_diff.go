@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"sort"
+	"strings"
+)
+
+// ServiceDiff is the difference between the previous services and the current services. The services are sorted by their names.
+type ServiceDiff struct {
+	Added   []*Service
+	Removed []*Service
+
+	// Updated are the services which are not equal to the previous services with the same names.
+	Updated []*ServiceUpdate
+}
+
+// ServiceUpdate is the pair of the previous service and the current service which have the same name.
+type ServiceUpdate struct {
+	Previous *Service
+	Current  *Service
+}
+
+// IsEmpty returns true if the services have not changed.
+func (d *ServiceDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// DiffServices compares the services with the same names by Equal, and returns the difference between them.
+func DiffServices(previous, current map[string]*Service) *ServiceDiff {
+	diff := &ServiceDiff{}
+
+	for name, c := range current {
+		p, ok := previous[name]
+		if !ok {
+			diff.Added = append(diff.Added, c)
+			continue
+		}
+
+		if !c.Equal(p) {
+			diff.Updated = append(diff.Updated, &ServiceUpdate{
+				Previous: p,
+				Current:  c,
+			})
+		}
+	}
+
+	for name, p := range previous {
+		if _, ok := current[name]; !ok {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+
+	sortServices(diff.Added)
+	sortServices(diff.Removed)
+	sort.SliceStable(diff.Updated, func(i, j int) bool {
+		return strings.Compare(diff.Updated[i].Current.Name, diff.Updated[j].Current.Name) < 0
+	})
+
+	return diff
+}
+
+func sortServices(services []*Service) {
+	sort.SliceStable(services, func(i, j int) bool {
+		return strings.Compare(services[i].Name, services[j].Name) < 0
+	})
+}
@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffServices(t *testing.T) {
+	t.Parallel()
+
+	newService := func(name, host string) *Service {
+		return &Service{
+			Name: name,
+			DefaultRoute: &Route{
+				Name: name,
+				Host: host,
+			},
+		}
+	}
+
+	for name, test := range map[string]struct {
+		previous map[string]*Service
+		current  map[string]*Service
+		want     *ServiceDiff
+	}{
+		"should return the empty diff if the services have not changed": {
+			previous: map[string]*Service{
+				"test-1": newService("test-1", "test-1.example.com"),
+			},
+			current: map[string]*Service{
+				"test-1": newService("test-1", "test-1.example.com"),
+			},
+			want: &ServiceDiff{},
+		},
+		"should return all services as added if there are no previous services": {
+			previous: nil,
+			current: map[string]*Service{
+				"test-2": newService("test-2", "test-2.example.com"),
+				"test-1": newService("test-1", "test-1.example.com"),
+			},
+			want: &ServiceDiff{
+				Added: []*Service{
+					newService("test-1", "test-1.example.com"),
+					newService("test-2", "test-2.example.com"),
+				},
+			},
+		},
+		"should return added, removed and updated services": {
+			previous: map[string]*Service{
+				"test-1": newService("test-1", "test-1.example.com"),
+				"test-2": newService("test-2", "test-2.example.com"),
+				"test-3": newService("test-3", "test-3.example.com"),
+			},
+			current: map[string]*Service{
+				"test-1": newService("test-1", "test-1.example.com"),
+				"test-2": newService("test-2", "test-2-new.example.com"),
+				"test-4": newService("test-4", "test-4.example.com"),
+			},
+			want: &ServiceDiff{
+				Added: []*Service{
+					newService("test-4", "test-4.example.com"),
+				},
+				Removed: []*Service{
+					newService("test-3", "test-3.example.com"),
+				},
+				Updated: []*ServiceUpdate{
+					{
+						Previous: newService("test-2", "test-2.example.com"),
+						Current:  newService("test-2", "test-2-new.example.com"),
+					},
+				},
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := DiffServices(test.previous, test.current)
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+
+			if got.IsEmpty() != test.want.IsEmpty() {
+				t.Errorf("want IsEmpty %v, got %v", test.want.IsEmpty(), got.IsEmpty())
+			}
+		})
+	}
+}
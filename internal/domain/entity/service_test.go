@@ -293,6 +293,44 @@ func TestServiceRoute(t *testing.T) {
 			},
 			want: false,
 		},
+		"should return false if two services have different Aliases": {
+			service: &Service{
+				Name: "test",
+				DefaultRoute: &Route{
+					Name: "test",
+					Host: "test.example.com",
+				},
+				Aliases: []string{"test.internal"},
+			},
+			other: &Service{
+				Name: "test",
+				DefaultRoute: &Route{
+					Name: "test",
+					Host: "test.example.com",
+				},
+				Aliases: []string{"test.internal", "test:443"},
+			},
+			want: false,
+		},
+		"should return false if two services have different VisibleTo": {
+			service: &Service{
+				Name: "test",
+				DefaultRoute: &Route{
+					Name: "test",
+					Host: "test.example.com",
+				},
+				VisibleTo: []string{"staging"},
+			},
+			other: &Service{
+				Name: "test",
+				DefaultRoute: &Route{
+					Name: "test",
+					Host: "test.example.com",
+				},
+				VisibleTo: []string{"production"},
+			},
+			want: false,
+		},
 		"should return false if the service passed as the argument is nil": {
 			service: &Service{
 				Name: "test",
@@ -327,3 +365,43 @@ func TestServiceRoute(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceIsVisibleTo(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		service *Service
+		group   string
+		want    bool
+	}{
+		"should return true if the service has no client group": {
+			service: &Service{Name: "test"},
+			group:   "staging",
+			want:    true,
+		},
+		"should return true if the service is visible to the client group": {
+			service: &Service{Name: "test", VisibleTo: []string{"qa", "staging"}},
+			group:   "staging",
+			want:    true,
+		},
+		"should return false if the service is not visible to the client group": {
+			service: &Service{Name: "test", VisibleTo: []string{"production"}},
+			group:   "staging",
+			want:    false,
+		},
+		"should return false if the client belongs to no group": {
+			service: &Service{Name: "test", VisibleTo: []string{"production"}},
+			group:   "",
+			want:    false,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.service.IsVisibleTo(test.group); got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
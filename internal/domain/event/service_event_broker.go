@@ -2,9 +2,21 @@ package event
 
 import (
 	"context"
+	"time"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
 )
 
+// ServicesRefreshedEvent is published when the refreshed services differ from the previous services.
+type ServicesRefreshedEvent struct {
+	Diff        *entity.ServiceDiff
+	RefreshedAt time.Time
+}
+
 type ServiceEventBroker interface {
-	PublishServicesRefreshedEvent(ctx context.Context) error
-	SubscribeServicesRefreshedEvent(ctx context.Context, subscriber func() error) error
+	PublishServicesRefreshedEvent(ctx context.Context, event *ServicesRefreshedEvent) error
+
+	// SubscribeServicesRefreshedEvent calls the subscriber with the context of each event, which is not derived from the context of the publisher
+	// since events are handled asynchronously.
+	SubscribeServicesRefreshedEvent(ctx context.Context, subscriber func(ctx context.Context, event *ServicesRefreshedEvent) error) error
 }
@@ -2,11 +2,22 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
 )
 
+// ErrServiceNotFound is returned if the service with the name does not exist.
+var ErrServiceNotFound = errors.New("service not found")
+
 type ServiceRepository interface {
 	ListAllServices(ctx context.Context) ([]*entity.Service, error)
-	RefreshServices(ctx context.Context) error
+	// GetService returns ErrServiceNotFound if the service with the name does not exist.
+	GetService(ctx context.Context, name string) (*entity.Service, error)
+	// RefreshServices refreshes the services and returns the difference from the services before the refresh.
+	// If the services are refreshed only partially, it returns the error along with the difference, keeping the previous services which failed to be refreshed.
+	RefreshServices(ctx context.Context) (*entity.ServiceDiff, error)
+	// LastRefreshedAt returns the time when the services were refreshed successfully for the last time. It is zero if they have never been refreshed.
+	LastRefreshedAt(ctx context.Context) (time.Time, error)
 }
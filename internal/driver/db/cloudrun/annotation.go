@@ -0,0 +1,613 @@
+package cloudrun
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/run/apiv2/runpb"
+	"github.com/samber/lo"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+const (
+	originServiceAnnotation  = "kauche.com/cloud-run-service-router-origin-service"
+	weightAnnotation         = "kauche.com/cloud-run-service-router-weight"
+	pathPrefixAnnotation     = "kauche.com/cloud-run-service-router-path-prefix"
+	grpcMethodsAnnotation    = "kauche.com/cloud-run-service-router-grpc-methods"
+	headerAnnotation         = "kauche.com/cloud-run-service-router-header"
+	matchAnnotation          = "kauche.com/cloud-run-service-router-match"
+	queryParameterAnnotation = "kauche.com/cloud-run-service-router-match-query-parameter"
+	timeoutAnnotation        = "kauche.com/cloud-run-service-router-timeout"
+	aliasesAnnotation        = "kauche.com/cloud-run-service-router-aliases"
+	visibleToAnnotation      = "kauche.com/cloud-run-service-router-visible-to"
+
+	retryOnAnnotation                   = "kauche.com/cloud-run-service-router-retry-on"
+	retryNumRetriesAnnotation           = "kauche.com/cloud-run-service-router-retry-num-retries"
+	retryPerTryTimeoutAnnotation        = "kauche.com/cloud-run-service-router-retry-per-try-timeout"
+	retryBackoffBaseIntervalAnnotation  = "kauche.com/cloud-run-service-router-retry-backoff-base-interval"
+	retryBackoffMaxIntervalAnnotation   = "kauche.com/cloud-run-service-router-retry-backoff-max-interval"
+	retryRetriableStatusCodesAnnotation = "kauche.com/cloud-run-service-router-retry-retriable-status-codes"
+	hedgeInitialRequestsAnnotation      = "kauche.com/cloud-run-service-router-hedge-initial-requests"
+	hedgeOnPerTryTimeoutAnnotation      = "kauche.com/cloud-run-service-router-hedge-on-per-try-timeout"
+
+	requestHeadersToAddAnnotation     = "kauche.com/cloud-run-service-router-request-headers-to-add"
+	requestHeadersToRemoveAnnotation  = "kauche.com/cloud-run-service-router-request-headers-to-remove"
+	responseHeadersToAddAnnotation    = "kauche.com/cloud-run-service-router-response-headers-to-add"
+	responseHeadersToRemoveAnnotation = "kauche.com/cloud-run-service-router-response-headers-to-remove"
+	servedByAnnotation                = "kauche.com/cloud-run-service-router-served-by"
+)
+
+// servedByHeader is the response header which has the name of the service which actually handled the request.
+const servedByHeader = "x-cloud-run-service-router-served-by"
+
+// inheritableAnnotations are the annotations of an origin service which are inherited by its route services unless they have their own.
+var inheritableAnnotations = []string{
+	retryOnAnnotation,
+	retryNumRetriesAnnotation,
+	retryPerTryTimeoutAnnotation,
+	retryBackoffBaseIntervalAnnotation,
+	retryBackoffMaxIntervalAnnotation,
+	retryRetriableStatusCodesAnnotation,
+	hedgeInitialRequestsAnnotation,
+	hedgeOnPerTryTimeoutAnnotation,
+	requestHeadersToAddAnnotation,
+	requestHeadersToRemoveAnnotation,
+	responseHeadersToAddAnnotation,
+	responseHeadersToRemoveAnnotation,
+	servedByAnnotation,
+}
+
+// retryOnConditions are the conditions supported by the `retry_on` of xDS retry policies.
+var retryOnConditions = map[string]struct{}{
+	"5xx":                        {},
+	"gateway-error":              {},
+	"reset":                      {},
+	"reset-before-request":       {},
+	"connect-failure":            {},
+	"envoy-ratelimited":          {},
+	"retriable-4xx":              {},
+	"refused-stream":             {},
+	"retriable-status-codes":     {},
+	"retriable-headers":          {},
+	"http3-post-connect-failure": {},
+	"cancelled":                  {},
+	"deadline-exceeded":          {},
+	"internal":                   {},
+	"resource-exhausted":         {},
+	"unavailable":                {},
+}
+
+// maxTotalWeight is the upper limit of the sum of weights of routes which belong to the same origin service.
+const maxTotalWeight = 100
+
+func parseWeight(annotations map[string]string) (uint32, error) {
+	v, ok := annotations[weightAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	weight, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the annotation `%s`: %w", weightAnnotation, err)
+	}
+
+	if weight > maxTotalWeight {
+		return 0, fmt.Errorf("the annotation `%s` must be between 0 and %d, but got %d", weightAnnotation, maxTotalWeight, weight)
+	}
+
+	return uint32(weight), nil
+}
+
+func parsePathPrefix(annotations map[string]string) (string, error) {
+	prefix, ok := annotations[pathPrefixAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	if !strings.HasPrefix(prefix, "/") {
+		return "", fmt.Errorf("the annotation `%s` must start with `/`, but got `%s`", pathPrefixAnnotation, prefix)
+	}
+
+	return prefix, nil
+}
+
+// parseGRPCMethods parses the comma-separated fully-qualified gRPC methods like `/pkg.Foo/Bar,/pkg.Foo/Baz`.
+// The returned methods are sorted and deduplicated.
+func parseGRPCMethods(annotations map[string]string) ([]string, error) {
+	v, ok := annotations[grpcMethodsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	var methods []string
+	for _, m := range strings.Split(v, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+
+		parts := strings.Split(m, "/")
+		if len(parts) != 3 || parts[0] != "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("the annotation `%s` must be a list of methods like `/pkg.Service/Method`, but got `%s`", grpcMethodsAnnotation, m)
+		}
+
+		methods = append(methods, m)
+	}
+
+	sort.Strings(methods)
+
+	return lo.Uniq(methods), nil
+}
+
+// parseMatcher parses the annotation formatted as `<kind>[:<value>]` where the kind is one of `exact`, `prefix`, `regex` and `present`.
+// Without the annotation, the route matches requests whose value is exactly same as the route name.
+// The name of the header is resolved by the origin service, so it is left empty if the matcher inspects the header.
+func parseMatcher(annotations map[string]string, routeName string) (entity.Matcher, error) {
+	matcher := entity.Matcher{
+		Source: entity.MatcherSourceHeader,
+		Kind:   entity.MatchKindExact,
+		Value:  routeName,
+	}
+
+	if name, ok := annotations[queryParameterAnnotation]; ok {
+		if name == "" {
+			return entity.Matcher{}, fmt.Errorf("the annotation `%s` must not be empty", queryParameterAnnotation)
+		}
+
+		matcher.Source = entity.MatcherSourceQueryParameter
+		matcher.Name = name
+	}
+
+	v, ok := annotations[matchAnnotation]
+	if !ok {
+		return matcher, nil
+	}
+
+	kind, value, hasValue := strings.Cut(v, ":")
+
+	switch kind {
+	case "exact":
+		matcher.Kind = entity.MatchKindExact
+	case "prefix":
+		matcher.Kind = entity.MatchKindPrefix
+	case "regex":
+		matcher.Kind = entity.MatchKindSafeRegex
+	case "present":
+		matcher.Kind = entity.MatchKindPresent
+		matcher.Value = ""
+
+		return matcher, nil
+	default:
+		return entity.Matcher{}, fmt.Errorf("the annotation `%s` has an unknown match kind `%s`", matchAnnotation, kind)
+	}
+
+	if hasValue {
+		if value == "" {
+			return entity.Matcher{}, fmt.Errorf("the annotation `%s` must not have an empty value", matchAnnotation)
+		}
+
+		matcher.Value = value
+	}
+
+	if matcher.Kind == entity.MatchKindSafeRegex {
+		if _, err := regexp.Compile(matcher.Value); err != nil {
+			return entity.Matcher{}, fmt.Errorf("the annotation `%s` has an invalid regular expression: %w", matchAnnotation, err)
+		}
+	}
+
+	return matcher, nil
+}
+
+// parseHeaderName returns the name of the header which pins requests to the route services of the origin service.
+// The annotation must be a lower-case header name since xDS clients match the names of headers in lower case.
+// The default name is used as lower-cased if the annotation does not exist.
+func parseHeaderName(annotations map[string]string, defaultName string) (string, error) {
+	name, ok := annotations[headerAnnotation]
+	if !ok {
+		return strings.ToLower(defaultName), nil
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("the annotation `%s` must not be empty", headerAnnotation)
+	}
+
+	if name != strings.ToLower(name) {
+		return "", fmt.Errorf("the annotation `%s` must be lower-case, but got `%s`", headerAnnotation, name)
+	}
+
+	if strings.ContainsFunc(name, func(c rune) bool { return !isHeaderNameChar(c) }) {
+		return "", fmt.Errorf("the annotation `%s` has an invalid header name `%s`", headerAnnotation, name)
+	}
+
+	return name, nil
+}
+
+// isHeaderNameChar returns true if the character can be used in lower-case header names, i.e. the `tchar` of RFC 9110.
+func isHeaderNameChar(c rune) bool {
+	return ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
+
+// parseTimeout returns the timeout of requests to the service.
+// The annotation formatted as a Go duration string (e.g. `300s`) takes precedence over the request timeout of the service's template.
+// Zero is returned only if neither of them exists so that the default timeout is used, and an explicit zero timeout is rejected
+// since it would be silently replaced by the default timeout.
+func parseTimeout(service *runpb.Service) (time.Duration, error) {
+	v, ok := service.Annotations[timeoutAnnotation]
+	if ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse the annotation `%s`: %w", timeoutAnnotation, err)
+		}
+
+		if timeout <= 0 {
+			return 0, fmt.Errorf("the annotation `%s` must be positive, but got `%s`", timeoutAnnotation, v)
+		}
+
+		return timeout, nil
+	}
+
+	if t := service.GetTemplate().GetTimeout(); t != nil {
+		timeout := t.AsDuration()
+		if timeout <= 0 {
+			return 0, fmt.Errorf("the timeout of the template must be positive, but got `%s`", timeout)
+		}
+
+		return timeout, nil
+	}
+
+	return 0, nil
+}
+
+// inheritAnnotations returns the annotations of the route service merged with the inheritable annotations of its origin service.
+func inheritAnnotations(origin, route map[string]string) map[string]string {
+	merged := make(map[string]string, len(route))
+	for _, k := range inheritableAnnotations {
+		if v, ok := origin[k]; ok {
+			merged[k] = v
+		}
+	}
+
+	for k, v := range route {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// parseRetryPolicy returns nil if the annotations do not have any retry policy.
+func parseRetryPolicy(annotations map[string]string) (*entity.RetryPolicy, error) {
+	v, ok := annotations[retryOnAnnotation]
+	if !ok {
+		for _, k := range []string{
+			retryNumRetriesAnnotation,
+			retryPerTryTimeoutAnnotation,
+			retryBackoffBaseIntervalAnnotation,
+			retryBackoffMaxIntervalAnnotation,
+			retryRetriableStatusCodesAnnotation,
+		} {
+			if _, ok := annotations[k]; ok {
+				return nil, fmt.Errorf("the annotation `%s` is required to use the annotation `%s`", retryOnAnnotation, k)
+			}
+		}
+
+		return nil, nil
+	}
+
+	policy := &entity.RetryPolicy{}
+
+	for _, c := range strings.Split(v, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		if _, ok := retryOnConditions[c]; !ok {
+			return nil, fmt.Errorf("the annotation `%s` has an unknown condition `%s`", retryOnAnnotation, c)
+		}
+
+		policy.RetryOn = append(policy.RetryOn, c)
+	}
+
+	if len(policy.RetryOn) == 0 {
+		return nil, fmt.Errorf("the annotation `%s` must not be empty", retryOnAnnotation)
+	}
+
+	sort.Strings(policy.RetryOn)
+	policy.RetryOn = lo.Uniq(policy.RetryOn)
+
+	if v, ok := annotations[retryNumRetriesAnnotation]; ok {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the annotation `%s`: %w", retryNumRetriesAnnotation, err)
+		}
+
+		policy.NumRetries = uint32(n)
+	}
+
+	var err error
+
+	policy.PerTryTimeout, err = parseDurationAnnotation(annotations, retryPerTryTimeoutAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.BaseInterval, err = parseDurationAnnotation(annotations, retryBackoffBaseIntervalAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.MaxInterval, err = parseDurationAnnotation(annotations, retryBackoffMaxIntervalAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.MaxInterval != 0 && policy.BaseInterval == 0 {
+		return nil, fmt.Errorf("the annotation `%s` is required to use the annotation `%s`", retryBackoffBaseIntervalAnnotation, retryBackoffMaxIntervalAnnotation)
+	}
+
+	if policy.MaxInterval != 0 && policy.MaxInterval < policy.BaseInterval {
+		return nil, fmt.Errorf("the annotation `%s` must not be less than the annotation `%s`", retryBackoffMaxIntervalAnnotation, retryBackoffBaseIntervalAnnotation)
+	}
+
+	if v, ok := annotations[retryRetriableStatusCodesAnnotation]; ok {
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+
+			code, err := strconv.ParseUint(c, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the annotation `%s`: %w", retryRetriableStatusCodesAnnotation, err)
+			}
+
+			if code < 100 || code > 599 {
+				return nil, fmt.Errorf("the annotation `%s` has an invalid status code `%d`", retryRetriableStatusCodesAnnotation, code)
+			}
+
+			policy.RetriableStatusCodes = append(policy.RetriableStatusCodes, uint32(code))
+		}
+
+		sort.Slice(policy.RetriableStatusCodes, func(i, j int) bool {
+			return policy.RetriableStatusCodes[i] < policy.RetriableStatusCodes[j]
+		})
+		policy.RetriableStatusCodes = lo.Uniq(policy.RetriableStatusCodes)
+	}
+
+	return policy, nil
+}
+
+// parseHedgePolicy returns nil if the annotations do not have any hedge policy.
+func parseHedgePolicy(annotations map[string]string) (*entity.HedgePolicy, error) {
+	initialRequests, hasInitialRequests := annotations[hedgeInitialRequestsAnnotation]
+	onPerTryTimeout, hasOnPerTryTimeout := annotations[hedgeOnPerTryTimeoutAnnotation]
+
+	if !hasInitialRequests && !hasOnPerTryTimeout {
+		return nil, nil
+	}
+
+	policy := &entity.HedgePolicy{}
+
+	if hasInitialRequests {
+		n, err := strconv.ParseUint(initialRequests, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the annotation `%s`: %w", hedgeInitialRequestsAnnotation, err)
+		}
+
+		if n == 0 {
+			return nil, fmt.Errorf("the annotation `%s` must be greater than 0", hedgeInitialRequestsAnnotation)
+		}
+
+		policy.InitialRequests = uint32(n)
+	}
+
+	if hasOnPerTryTimeout {
+		b, err := strconv.ParseBool(onPerTryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the annotation `%s`: %w", hedgeOnPerTryTimeoutAnnotation, err)
+		}
+
+		policy.HedgeOnPerTryTimeout = b
+	}
+
+	return policy, nil
+}
+
+func parseDurationAnnotation(annotations map[string]string, key string) (time.Duration, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the annotation `%s`: %w", key, err)
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("the annotation `%s` must not be negative, but got `%s`", key, v)
+	}
+
+	return d, nil
+}
+
+// parseHeaderMutation parses the header annotations of the service. The headers to add are formatted as `name: value, name: value`,
+// and the headers to remove are formatted as `name, name`. The served-by header is added to responses if the annotation is `true`.
+func parseHeaderMutation(annotations map[string]string, serviceName string) (entity.HeaderMutation, error) {
+	var mutation entity.HeaderMutation
+	var err error
+
+	mutation.RequestHeadersToAdd, err = parseHeadersToAdd(annotations, requestHeadersToAddAnnotation)
+	if err != nil {
+		return entity.HeaderMutation{}, err
+	}
+
+	mutation.RequestHeadersToRemove, err = parseHeadersToRemove(annotations, requestHeadersToRemoveAnnotation)
+	if err != nil {
+		return entity.HeaderMutation{}, err
+	}
+
+	mutation.ResponseHeadersToAdd, err = parseHeadersToAdd(annotations, responseHeadersToAddAnnotation)
+	if err != nil {
+		return entity.HeaderMutation{}, err
+	}
+
+	mutation.ResponseHeadersToRemove, err = parseHeadersToRemove(annotations, responseHeadersToRemoveAnnotation)
+	if err != nil {
+		return entity.HeaderMutation{}, err
+	}
+
+	if v, ok := annotations[servedByAnnotation]; ok {
+		servedBy, err := strconv.ParseBool(v)
+		if err != nil {
+			return entity.HeaderMutation{}, fmt.Errorf("failed to parse the annotation `%s`: %w", servedByAnnotation, err)
+		}
+
+		if servedBy {
+			mutation.ResponseHeadersToAdd = append(mutation.ResponseHeadersToAdd, entity.Header{
+				Name:  servedByHeader,
+				Value: serviceName,
+			})
+		}
+	}
+
+	return mutation, nil
+}
+
+func parseHeadersToAdd(annotations map[string]string, key string) ([]entity.Header, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var headers []entity.Header
+	for _, h := range strings.Split(v, ",") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("the annotation `%s` must be a list of headers like `name: value`, but got `%s`", key, strings.TrimSpace(h))
+		}
+
+		name, err := validateHeaderName(key, name)
+		if err != nil {
+			return nil, err
+		}
+
+		headers = append(headers, entity.Header{
+			Name:  name,
+			Value: strings.TrimSpace(value),
+		})
+	}
+
+	return headers, nil
+}
+
+func parseHeadersToRemove(annotations map[string]string, key string) ([]string, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var names []string
+	for _, h := range strings.Split(v, ",") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+
+		name, err := validateHeaderName(key, h)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return lo.Uniq(names), nil
+}
+
+// validateHeaderName returns the lower-cased header name, or an error if the header cannot be mutated by xDS.
+func validateHeaderName(key, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if name == "" {
+		return "", fmt.Errorf("the annotation `%s` has an empty header name", key)
+	}
+
+	if strings.HasPrefix(name, ":") || name == "host" {
+		return "", fmt.Errorf("the annotation `%s` cannot mutate the header `%s`", key, name)
+	}
+
+	if strings.ContainsFunc(name, func(c rune) bool { return !isHeaderNameChar(c) }) {
+		return "", fmt.Errorf("the annotation `%s` has an invalid header name `%s`", key, name)
+	}
+
+	return name, nil
+}
+
+// parseAliases parses the comma-separated aliases of the origin service like `payments.internal,payments:443`.
+// The returned aliases are sorted and deduplicated, and do not have the name of the service.
+func parseAliases(annotations map[string]string, serviceName string) ([]string, error) {
+	v, ok := annotations[aliasesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	var aliases []string
+	for _, a := range strings.Split(v, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" || a == serviceName {
+			continue
+		}
+
+		if strings.ContainsAny(a, " \t/") {
+			return nil, fmt.Errorf("the annotation `%s` must be a list of domains or listener names like `payments.internal,payments:443`, but got `%s`", aliasesAnnotation, a)
+		}
+
+		aliases = append(aliases, a)
+	}
+
+	sort.Strings(aliases)
+
+	return lo.Uniq(aliases), nil
+}
+
+// parseVisibleTo returns the groups of clients to which the service is distributed, like `staging,qa`.
+func parseVisibleTo(annotations map[string]string) ([]string, error) {
+	v, ok := annotations[visibleToAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	var groups []string
+	for _, g := range strings.Split(v, ",") {
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+
+		if strings.ContainsAny(g, " \t") {
+			return nil, fmt.Errorf("the annotation `%s` must be a list of client groups like `staging,qa`, but got `%s`", visibleToAnnotation, g)
+		}
+
+		groups = append(groups, g)
+	}
+
+	// NOTE: the annotation which has no group is rejected since it would be distributed to all clients against the intention to restrict it.
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("the annotation `%s` must have at least one client group", visibleToAnnotation)
+	}
+
+	sort.Strings(groups)
+
+	return lo.Uniq(groups), nil
+}
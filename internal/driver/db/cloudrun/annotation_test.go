@@ -0,0 +1,380 @@
+package cloudrun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/run/apiv2/runpb"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+var invalidAnnotationServices = []*runpb.Service{
+	{
+		Name: "projects/test-project/locations/invalid-location/services/origin-service-a",
+		Uri:  "https://origin-service-a-test-il.a.run.app",
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-a-1",
+		Uri:  "https://route-service-a-1-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-a",
+			weightAnnotation:        "60",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-a-2",
+		Uri:  "https://route-service-a-2-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-a",
+			weightAnnotation:        "50",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-a-3",
+		Uri:  "https://route-service-a-3-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-a",
+			weightAnnotation:        "ten",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-a-4",
+		Uri:  "https://route-service-a-4-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-a",
+			matchAnnotation:         "suffix:-pr",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-a-5",
+		Uri:  "https://route-service-a-5-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation:   "origin-service-a",
+			retryNumRetriesAnnotation: "3",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/origin-service-b",
+		Uri:  "https://origin-service-b-test-il.a.run.app",
+		Annotations: map[string]string{
+			retryOnAnnotation: "sometimes",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-b-1",
+		Uri:  "https://route-service-b-1-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-b",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/origin-service-c",
+		Uri:  "https://origin-service-c-test-il.a.run.app",
+		Annotations: map[string]string{
+			visibleToAnnotation: ",",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/origin-service-d",
+		Uri:  "https://origin-service-d-test-il.a.run.app",
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/origin-service-e",
+		Uri:  "https://origin-service-e-test-il.a.run.app",
+		Annotations: map[string]string{
+			headerAnnotation: "",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-e-1",
+		Uri:  "https://route-service-e-1-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation: "origin-service-e",
+		},
+	},
+	{
+		Name: "projects/test-project/locations/invalid-location/services/route-service-e-2",
+		Uri:  "https://route-service-e-2-test-il.a.run.app",
+		Annotations: map[string]string{
+			originServiceAnnotation:  "origin-service-e",
+			queryParameterAnnotation: "route",
+		},
+	},
+}
+
+func TestRefreshServices_InvalidAnnotations(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project"}, []string{"invalid-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	if _, err := repo.RefreshServices(ctx); err != nil {
+		t.Errorf("want the services with invalid annotations to be skipped, but got %s", err)
+		return
+	}
+
+	services, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	type route struct {
+		Name   string
+		Weight uint32
+	}
+
+	got := make(map[string][]route)
+	for _, s := range services {
+		routes := []route{}
+		for _, r := range s.Routes {
+			routes = append(routes, route{Name: r.Name, Weight: r.Weight})
+		}
+
+		got[s.Name] = routes
+	}
+
+	// NOTE: route-service-a-2 is skipped since the total weight exceeds 100 after route-service-a-1 has taken 60,
+	// and route-service-e-1 is skipped since the header name of its origin service is empty.
+	want := map[string][]route{
+		"origin-service-a": {{Name: "route-service-a-1", Weight: 60}},
+		"origin-service-d": {},
+		"origin-service-e": {{Name: "route-service-e-2"}},
+	}
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
+
+func TestParseHeaderName(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		"should return the lower-cased default name if the annotation does not exist": {
+			annotations: map[string]string{},
+			want:        "x-route-service-1",
+		},
+		"should return the header name of the annotation": {
+			annotations: map[string]string{headerAnnotation: "x-canary"},
+			want:        "x-canary",
+		},
+		"should return an error if the header name is empty": {
+			annotations: map[string]string{headerAnnotation: ""},
+			wantErr:     true,
+		},
+		"should return an error if the header name is not lower-case": {
+			annotations: map[string]string{headerAnnotation: "X-Canary"},
+			wantErr:     true,
+		},
+		"should return an error if the header name has an invalid character": {
+			annotations: map[string]string{headerAnnotation: "x canary"},
+			wantErr:     true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseHeaderName(test.annotations, "X-Route-Service-1")
+			if (err != nil) != test.wantErr {
+				t.Errorf("want error %t, got %v", test.wantErr, err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateHeaderName(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		"should return the trimmed and lower-cased header name": {
+			name: " X-Canary ",
+			want: "x-canary",
+		},
+		"should return an error if the header name is empty": {
+			name:    " ",
+			wantErr: true,
+		},
+		"should return an error if the header is a pseudo-header": {
+			name:    ":authority",
+			wantErr: true,
+		},
+		"should return an error if the header is host": {
+			name:    "Host",
+			wantErr: true,
+		},
+		"should return an error if the header name has a space": {
+			name:    "x canary",
+			wantErr: true,
+		},
+		"should return an error if the header name has an invalid character": {
+			name:    "x-canary@",
+			wantErr: true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := validateHeaderName(requestHeadersToRemoveAnnotation, test.name)
+			if (err != nil) != test.wantErr {
+				t.Errorf("want error %t, got %v", test.wantErr, err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		service *runpb.Service
+		want    time.Duration
+		wantErr bool
+	}{
+		"should return zero if neither the annotation nor the template has the timeout": {
+			service: &runpb.Service{},
+			want:    0,
+		},
+		"should return the timeout of the template": {
+			service: &runpb.Service{
+				Template: &runpb.RevisionTemplate{Timeout: durationpb.New(300 * time.Second)},
+			},
+			want: 300 * time.Second,
+		},
+		"should return the timeout of the annotation in preference to the template": {
+			service: &runpb.Service{
+				Annotations: map[string]string{timeoutAnnotation: "1h"},
+				Template:    &runpb.RevisionTemplate{Timeout: durationpb.New(300 * time.Second)},
+			},
+			want: time.Hour,
+		},
+		"should return an error if the annotation is zero": {
+			service: &runpb.Service{
+				Annotations: map[string]string{timeoutAnnotation: "0s"},
+			},
+			wantErr: true,
+		},
+		"should return an error if the annotation is negative": {
+			service: &runpb.Service{
+				Annotations: map[string]string{timeoutAnnotation: "-1s"},
+			},
+			wantErr: true,
+		},
+		"should return an error if the timeout of the template is zero": {
+			service: &runpb.Service{
+				Template: &runpb.RevisionTemplate{Timeout: durationpb.New(0)},
+			},
+			wantErr: true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseTimeout(test.service)
+			if (err != nil) != test.wantErr {
+				t.Errorf("want error %t, got %v", test.wantErr, err)
+			}
+
+			if got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRemoveConflictingAliases(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		services map[string][]string
+		want     map[string][]string
+		wantErrs int
+	}{
+		"should keep the aliases which do not conflict": {
+			services: map[string][]string{
+				"service-1": {"service-1.internal"},
+				"service-2": {"service-2.internal"},
+			},
+			want: map[string][]string{
+				"service-1": {"service-1.internal"},
+				"service-2": {"service-2.internal"},
+			},
+		},
+		"should remove the alias which is same as the name of another service": {
+			services: map[string][]string{
+				"service-1": nil,
+				"service-2": {"service-1", "service-2.internal"},
+			},
+			want: map[string][]string{
+				"service-1": nil,
+				"service-2": {"service-2.internal"},
+			},
+			wantErrs: 1,
+		},
+		"should keep the shared alias only for the service which comes first by name": {
+			services: map[string][]string{
+				"service-1": {"shared.internal"},
+				"service-2": {"shared.internal"},
+			},
+			want: map[string][]string{
+				"service-1": {"shared.internal"},
+				"service-2": nil,
+			},
+			wantErrs: 1,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			servicesMap := make(map[string]*entity.Service)
+			for name, aliases := range test.services {
+				servicesMap[name] = &entity.Service{Name: name, Aliases: aliases}
+			}
+
+			errs := removeConflictingAliases(servicesMap)
+			if len(errs) != test.wantErrs {
+				t.Errorf("want %d errors, got %v", test.wantErrs, errs)
+			}
+
+			got := make(map[string][]string)
+			for name, s := range servicesMap {
+				got[name] = s.Aliases
+			}
+
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
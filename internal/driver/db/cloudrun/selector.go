@@ -0,0 +1,177 @@
+package cloudrun
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type selectorOperator int
+
+const (
+	selectorOperatorEquals selectorOperator = iota
+	selectorOperatorNotEquals
+	selectorOperatorIn
+	selectorOperatorNotIn
+	selectorOperatorExists
+	selectorOperatorDoesNotExist
+)
+
+const (
+	selectorKeyPattern   = `[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?`
+	selectorValuePattern = `([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?`
+)
+
+var (
+	selectorSetRequirementRegexp       = regexp.MustCompile(`^(` + selectorKeyPattern + `)\s+(in|notin)\s+\((.*)\)$`)
+	selectorEqualityRequirementRegexp  = regexp.MustCompile(`^(` + selectorKeyPattern + `)\s*(==|=|!=)\s*(` + selectorValuePattern + `)$`)
+	selectorExistenceRequirementRegexp = regexp.MustCompile(`^(!?)\s*(` + selectorKeyPattern + `)$`)
+	selectorValueRegexp                = regexp.MustCompile(`^` + selectorValuePattern + `$`)
+)
+
+// selectorRequirement is a requirement of a label selector like `team=payments` or `env in (dev,stg)`.
+type selectorRequirement struct {
+	raw      string
+	key      string
+	operator selectorOperator
+	values   []string
+}
+
+// selector is the Kubernetes-style label selector. Labels satisfy the selector if they satisfy all requirements.
+// The empty selector is satisfied by any labels.
+type selector []selectorRequirement
+
+// parseSelector parses the comma-separated requirements. Each requirement is one of
+// `key=value`, `key==value`, `key!=value`, `key in (value,...)`, `key notin (value,...)`, `key` and `!key`.
+func parseSelector(s string) (selector, error) {
+	var sel selector
+
+	for _, raw := range splitSelector(s) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		req, err := parseSelectorRequirement(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+// splitSelector splits the selector by the commas which are not in parentheses.
+func splitSelector(s string) []string {
+	var parts []string
+
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func parseSelectorRequirement(raw string) (selectorRequirement, error) {
+	if m := selectorSetRequirementRegexp.FindStringSubmatch(raw); m != nil {
+		req := selectorRequirement{
+			raw:      raw,
+			key:      m[1],
+			operator: selectorOperatorIn,
+		}
+
+		if m[3] == "notin" {
+			req.operator = selectorOperatorNotIn
+		}
+
+		for _, v := range strings.Split(m[4], ",") {
+			v = strings.TrimSpace(v)
+			if !selectorValueRegexp.MatchString(v) {
+				return selectorRequirement{}, fmt.Errorf("the selector requirement `%s` has an invalid value `%s`", raw, v)
+			}
+
+			req.values = append(req.values, v)
+		}
+
+		return req, nil
+	}
+
+	if m := selectorEqualityRequirementRegexp.FindStringSubmatch(raw); m != nil {
+		req := selectorRequirement{
+			raw:      raw,
+			key:      m[1],
+			operator: selectorOperatorEquals,
+			values:   []string{m[4]},
+		}
+
+		if m[3] == "!=" {
+			req.operator = selectorOperatorNotEquals
+		}
+
+		return req, nil
+	}
+
+	if m := selectorExistenceRequirementRegexp.FindStringSubmatch(raw); m != nil {
+		req := selectorRequirement{
+			raw:      raw,
+			key:      m[2],
+			operator: selectorOperatorExists,
+		}
+
+		if m[1] == "!" {
+			req.operator = selectorOperatorDoesNotExist
+		}
+
+		return req, nil
+	}
+
+	return selectorRequirement{}, fmt.Errorf("the selector requirement `%s` is invalid", raw)
+}
+
+// matches returns true if the labels satisfy the selector. Otherwise, it returns false with the reason.
+func (s selector) matches(labels map[string]string) (bool, string) {
+	for _, req := range s {
+		if !req.matches(labels) {
+			v, ok := labels[req.key]
+			if !ok {
+				return false, fmt.Sprintf("the label `%s` does not exist, which does not satisfy `%s`", req.key, req.raw)
+			}
+
+			return false, fmt.Sprintf("the label `%s` is `%s`, which does not satisfy `%s`", req.key, v, req.raw)
+		}
+	}
+
+	return true, ""
+}
+
+func (r selectorRequirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+
+	switch r.operator {
+	case selectorOperatorEquals, selectorOperatorIn:
+		return ok && slices.Contains(r.values, v)
+	case selectorOperatorNotEquals, selectorOperatorNotIn:
+		return !ok || !slices.Contains(r.values, v)
+	case selectorOperatorExists:
+		return ok
+	case selectorOperatorDoesNotExist:
+		return !ok
+	}
+
+	return false
+}
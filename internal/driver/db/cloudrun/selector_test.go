@@ -0,0 +1,105 @@
+package cloudrun
+
+import "testing"
+
+func TestSelectorMatches(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		selector string
+		labels   map[string]string
+		want     bool
+	}{
+		"should match any labels if the selector is empty": {
+			selector: "",
+			labels:   map[string]string{"team": "payments"},
+			want:     true,
+		},
+		"should match if the label equals to the value": {
+			selector: "team=payments",
+			labels:   map[string]string{"team": "payments"},
+			want:     true,
+		},
+		"should match if the label equals to the value with the double equal sign": {
+			selector: "team == payments",
+			labels:   map[string]string{"team": "payments"},
+			want:     true,
+		},
+		"should not match if the label does not equal to the value": {
+			selector: "team=payments",
+			labels:   map[string]string{"team": "search"},
+			want:     false,
+		},
+		"should match if the label which must not equal to the value does not exist": {
+			selector: "routable!=false",
+			labels:   map[string]string{},
+			want:     true,
+		},
+		"should not match if the label equals to the value which must not be": {
+			selector: "team=payments,routable!=false",
+			labels:   map[string]string{"team": "payments", "routable": "false"},
+			want:     false,
+		},
+		"should match if the label is in the values": {
+			selector: "env in (dev, stg),team",
+			labels:   map[string]string{"env": "stg", "team": "payments"},
+			want:     true,
+		},
+		"should not match if the label is not in the values": {
+			selector: "env in (dev,stg)",
+			labels:   map[string]string{"env": "prd"},
+			want:     false,
+		},
+		"should match if the label is not in the values which must not be": {
+			selector: "env notin (prd)",
+			labels:   map[string]string{"env": "dev"},
+			want:     true,
+		},
+		"should not match if the label which must exist does not exist": {
+			selector: "team",
+			labels:   map[string]string{},
+			want:     false,
+		},
+		"should not match if the label which must not exist exists": {
+			selector: "!batch",
+			labels:   map[string]string{"batch": ""},
+			want:     false,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sel, err := parseSelector(test.selector)
+			if err != nil {
+				t.Errorf("failed to parse the selector: %s", err)
+				return
+			}
+
+			got, _ := sel.matches(test.labels)
+			if got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, selector := range []string{
+		"team=pay ments",
+		"=payments",
+		"env in (dev,st g)",
+		"team>1",
+	} {
+		selector := selector
+		t.Run(selector, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := parseSelector(selector); err == nil {
+				t.Errorf("want an error for the selector `%s`, but got nil", selector)
+			}
+		})
+	}
+}
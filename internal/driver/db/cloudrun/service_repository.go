@@ -3,17 +3,25 @@ package cloudrun
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	run "cloud.google.com/go/run/apiv2"
 	"cloud.google.com/go/run/apiv2/runpb"
+	"github.com/go-logr/logr"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
@@ -21,25 +29,66 @@ import (
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/repository"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
 )
 
-const originServiceAnnotation = "kauche.com/cloud-run-service-router-origin-service"
-
 var _ repository.ServiceRepository = (*ServiceRepository)(nil)
 
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/driver/db/cloudrun")
+
 type ServiceRepository struct {
 	client *run.ServicesClient
 
-	project  string
-	location string
+	parents      []parent
+	headerPrefix string
+	selector     selector
+
+	metrics *telemetry.Metrics
+	logger  logr.Logger
+
+	// refreshMu serializes refreshes, which can be triggered by both of the ticker and change notifications,
+	// so that services listed earlier never overwrite services listed later.
+	refreshMu sync.Mutex
 
 	servicesMu struct {
 		sync.RWMutex
 		services map[string]*entity.Service
+
+		// parentServices are the services listed from each parent for the last time, which are in the same order as the parents.
+		// They are kept for the parent whose listing fails so that its services do not disappear.
+		parentServices [][]*entity.Service
+
+		// refreshedAt is the time when the services of all parents were refreshed successfully for the last time.
+		refreshedAt time.Time
 	}
 }
 
-func NewServiceRepository(ctx context.Context, project, location string, emulatorHost string) (*ServiceRepository, error) {
+// parent is the pair of the project and the location where services are listed.
+type parent struct {
+	project  string
+	location string
+}
+
+func (p parent) String() string {
+	return fmt.Sprintf("projects/%s/locations/%s", p.project, p.location)
+}
+
+// NewServiceRepository creates a ServiceRepository which lists services in all combinations of the projects and the locations.
+// The order of the projects and the locations decides which service takes the unqualified name on name collisions (see mergeServices).
+// The headerPrefix followed by the origin service name is used as the header name to match requests to route services
+// unless the origin service has its own header name.
+// Only the services whose labels satisfy the serviceSelector, which is a Kubernetes-style label selector, become origin services or route services.
+func NewServiceRepository(ctx context.Context, projects, locations []string, headerPrefix, serviceSelector string, emulatorHost string, metrics *telemetry.Metrics, logger logr.Logger) (*ServiceRepository, error) {
+	if len(projects) == 0 || len(locations) == 0 {
+		return nil, errors.New("at least one project and one location are required")
+	}
+
+	sel, err := parseSelector(serviceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the service selector: %w", err)
+	}
+
 	var opts []option.ClientOption
 
 	if emulatorHost != "" {
@@ -51,15 +100,26 @@ func NewServiceRepository(ctx context.Context, project, location string, emulato
 		)
 	}
 
+	// NOTE: the calls of the client are traced by the global tracer provider.
 	client, err := run.NewServicesClient(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create a cloud run client: %w", err)
 	}
 
+	var parents []parent
+	for _, project := range projects {
+		for _, location := range locations {
+			parents = append(parents, parent{project: project, location: location})
+		}
+	}
+
 	return &ServiceRepository{
-		client:   client,
-		project:  project,
-		location: location,
+		client:       client,
+		parents:      parents,
+		headerPrefix: headerPrefix,
+		selector:     sel,
+		metrics:      metrics,
+		logger:       logger,
 	}, nil
 }
 
@@ -70,43 +130,157 @@ func (s *ServiceRepository) ListAllServices(ctx context.Context) ([]*entity.Serv
 	return lo.Values(s.servicesMu.services), nil
 }
 
-func (s *ServiceRepository) RefreshServices(ctx context.Context) error {
+func (s *ServiceRepository) GetService(ctx context.Context, name string) (*entity.Service, error) {
+	s.servicesMu.RLock()
+	defer s.servicesMu.RUnlock()
+
+	service, ok := s.servicesMu.services[name]
+	if !ok {
+		return nil, fmt.Errorf("the service `%s` does not exist: %w", name, repository.ErrServiceNotFound)
+	}
+
+	return service, nil
+}
+
+func (s *ServiceRepository) LastRefreshedAt(ctx context.Context) (time.Time, error) {
+	s.servicesMu.RLock()
+	defer s.servicesMu.RUnlock()
+
+	return s.servicesMu.refreshedAt, nil
+}
+
+// RefreshServices lists services of all parents concurrently and replaces the services with them.
+// If listing services of a parent fails, the error is logged and the previous services of only the parent are kept,
+// so that the services of the parent do not disappear while the services of the other parents are still refreshed.
+// It returns the difference from the previous services, along with the errors of the failed parents if any.
+func (s *ServiceRepository) RefreshServices(ctx context.Context) (*entity.ServiceDiff, error) {
+	ctx, span := tracer.Start(ctx, "ServiceRepository.RefreshServices")
+	defer span.End()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	results := make([][]*entity.Service, len(s.parents))
+	errs := make([]error, len(s.parents))
+
+	var wg sync.WaitGroup
+	for i, p := range s.parents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, span := tracer.Start(ctx, "ServiceRepository.listServices", trace.WithAttributes(attribute.String("parent", p.String())))
+			defer span.End()
+
+			start := time.Now()
+			services, err := s.listServices(ctx, p)
+			s.metrics.ObserveListServices(p.String(), time.Since(start), err)
+			if err != nil {
+				errs[i] = tracing.RecordError(span, fmt.Errorf("failed to list services of `%s`: %w", p, err))
+				return
+			}
+
+			span.SetAttributes(attribute.Int("services.count", len(services)))
+
+			results[i] = services
+		}()
+	}
+
+	wg.Wait()
+
 	s.servicesMu.Lock()
 	defer s.servicesMu.Unlock()
 
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		s.logger.Error(err, "kept the previous services of the parent since listing its services has failed", "parent", s.parents[i].String())
+
+		if s.servicesMu.parentServices != nil {
+			results[i] = s.servicesMu.parentServices[i]
+		}
+	}
+
+	listErr := errors.Join(errs...)
+	if listErr != nil {
+		tracing.RecordError(span, listErr)
+	}
+
+	servicesMap, collisions := mergeServices(s.parents, results)
+
+	for _, c := range collisions {
+		s.logger.Info("qualified the name of the service since another service has already taken it", "service", c.name, "qualifiedName", c.qualifiedName, "parent", c.parent.String())
+	}
+
+	for _, err := range removeConflictingAliases(servicesMap) {
+		s.logger.Error(err, "removed the conflicting alias")
+	}
+
+	diff := entity.DiffServices(s.servicesMu.services, servicesMap)
+
+	s.servicesMu.services = servicesMap
+	s.servicesMu.parentServices = results
+
+	var routeServices int
+	for _, service := range servicesMap {
+		routeServices += len(service.Routes)
+	}
+
+	// NOTE: the services of the failed parents may be stale, so the refresh is observed only if all parents have succeeded.
+	if listErr == nil {
+		s.servicesMu.refreshedAt = time.Now()
+		s.metrics.ObserveRefresh(len(servicesMap), routeServices)
+	}
+
+	span.SetAttributes(
+		attribute.Int("services.count", len(servicesMap)),
+		attribute.Int("routes.count", routeServices),
+	)
+
+	return diff, listErr
+}
+
+// listServices lists services of the parent and links route services to their origin services in the same parent.
+// A service or a route with invalid annotations is skipped with an error log instead of failing the whole refresh,
+// so that a single misconfigured service does not freeze the routing of all other services.
+func (s *ServiceRepository) listServices(ctx context.Context, p parent) ([]*entity.Service, error) {
 	// NOTE: since the paging is done by the client internally, we don't need to set PageSize and PageToken.
 	req := &runpb.ListServicesRequest{
-		Parent:      fmt.Sprintf("projects/%s/locations/%s", s.project, s.location),
+		Parent:      p.String(),
 		ShowDeleted: false,
 	}
 	iter := s.client.ListServices(ctx, req)
 
-	servicesMap := make(map[string]*entity.Service)
+	var services []*entity.Service
 	serviceNameToOriginServiceMap := make(map[string]*entity.Service)
 	serviceNameToRouteServiceMap := make(map[string]map[string]*entity.Route)
+	serviceNameToAnnotationsMap := make(map[string]map[string]string)
 	for {
 		service, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("failed to iterate services: %w", err)
+			return nil, fmt.Errorf("failed to iterate services: %w", err)
 		}
 
-		uri, err := url.Parse(service.Uri)
-		if err != nil {
-			return fmt.Errorf("failed to parse service uri: %w", err)
+		if ok, reason := s.selector.matches(service.Labels); !ok {
+			s.logger.V(1).Info("excluded the service by the service selector", "service", service.Name, "reason", reason)
+			continue
 		}
 
 		serviceName := filepath.Base(service.Name)
 
 		originServiceName, ok := service.Annotations[originServiceAnnotation]
 		if ok {
-			route := &entity.Route{
-				Name:    serviceName,
-				Version: fmt.Sprintf("%s-%d", service.Uid, service.Generation),
-				Host:    uri.Host,
+			route, err := newRoute(service, serviceName)
+			if err != nil {
+				s.logger.Error(err, "skipped the route service since it is invalid", "service", service.Name)
+				continue
 			}
+
 			_, ok := serviceNameToRouteServiceMap[originServiceName]
 			if ok {
 				serviceNameToRouteServiceMap[originServiceName][route.Name] = route
@@ -116,52 +290,331 @@ func (s *ServiceRepository) RefreshServices(ctx context.Context) error {
 				}
 			}
 		} else {
-			serviceNameToOriginServiceMap[serviceName] = &entity.Service{
-				Name: serviceName,
-				DefaultRoute: &entity.Route{
-					Name:    serviceName,
-					Host:    uri.Host,
-					Version: fmt.Sprintf("%s-%d", service.Uid, service.Generation),
-				},
+			originService, err := newOriginService(service, serviceName)
+			if err != nil {
+				s.logger.Error(err, "skipped the origin service since it is invalid", "service", service.Name)
+				continue
 			}
+
+			serviceNameToOriginServiceMap[serviceName] = originService
 		}
+
+		serviceNameToAnnotationsMap[serviceName] = service.Annotations
 	}
 
 	for name, originService := range serviceNameToOriginServiceMap {
-		routes, ok := serviceNameToRouteServiceMap[name]
-		if ok {
-			originService.Routes = routes
-		}
+		rs := lo.Values(serviceNameToRouteServiceMap[name])
 
-		rs := make([]*entity.Route, len(routes))
-		i := 0
-		for _, r := range routes {
-			rs[i] = r
-			i++
-		}
 		sort.SliceStable(rs, func(i, j int) bool {
 			return strings.Compare(rs[i].Name, rs[j].Name) < 0
 		})
 
+		// NOTE: the routes matched by the query parameter are still available even if the header name is invalid.
+		headerName, headerNameErr := parseHeaderName(serviceNameToAnnotationsMap[name], s.headerPrefix+name)
+
+		var routes []*entity.Route
+		var totalWeight uint32
+		for _, r := range rs {
+			if r.Matcher.Source == entity.MatcherSourceHeader {
+				if headerNameErr != nil {
+					s.logger.Error(headerNameErr, "skipped the route service since the header name of its origin service is invalid", "service", r.Name, "origin", name)
+					continue
+				}
+
+				r.Matcher.Name = headerName
+			}
+
+			annotations := inheritAnnotations(serviceNameToAnnotationsMap[name], serviceNameToAnnotationsMap[r.Name])
+
+			if err := parseRoutePolicies(r, annotations); err != nil {
+				s.logger.Error(err, "skipped the route service since it is invalid", "service", r.Name, "origin", name)
+				continue
+			}
+
+			// NOTE: the routes are accepted in the order of their names as long as the total weight does not exceed the limit.
+			if totalWeight+r.Weight > maxTotalWeight {
+				err := fmt.Errorf("the total weight of the routes of the service `%s` exceeds %d", name, maxTotalWeight)
+				s.logger.Error(err, "skipped the route service since its weight exceeds the remaining weight", "service", r.Name, "origin", name, "weight", r.Weight, "remaining", maxTotalWeight-totalWeight)
+				continue
+			}
+
+			totalWeight += r.Weight
+			routes = append(routes, r)
+		}
+
+		if len(routes) > 0 {
+			originService.Routes = make(map[string]*entity.Route, len(routes))
+			for _, r := range routes {
+				originService.Routes[r.Name] = r
+			}
+		}
+
 		hash := sha256.New()
 		_, err := io.WriteString(hash, originService.DefaultRoute.Name)
 		if err != nil {
-			return fmt.Errorf("failed to write a default route name to the service version hash: %w", err)
+			return nil, fmt.Errorf("failed to write a default route name to the service version hash: %w", err)
 		}
 
-		for _, r := range rs {
+		for _, r := range routes {
 			_, err := io.WriteString(hash, r.Name)
 			if err != nil {
-				return fmt.Errorf("failed to write the route, %s, name to the service version hash: %w", r.Name, err)
+				return nil, fmt.Errorf("failed to write the route, %s, name to the service version hash: %w", r.Name, err)
+			}
+		}
+
+		for _, a := range originService.Aliases {
+			_, err := io.WriteString(hash, a)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write the alias, %s, to the service version hash: %w", a, err)
+			}
+		}
+
+		for _, g := range originService.VisibleTo {
+			_, err := io.WriteString(hash, "visible-to/"+g)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write the client group, %s, to the service version hash: %w", g, err)
 			}
 		}
 
 		originService.Version = fmt.Sprintf("%x", hash.Sum(nil))
 
-		servicesMap[originService.Name] = originService
+		services = append(services, originService)
 	}
 
-	s.servicesMu.services = servicesMap
+	sort.SliceStable(services, func(i, j int) bool {
+		return strings.Compare(services[i].Name, services[j].Name) < 0
+	})
+
+	return services, nil
+}
+
+// newRoute returns the route of the route service, whose matcher does not have the header name yet
+// and whose policies are not parsed yet since both of them depend on the origin service.
+func newRoute(service *runpb.Service, serviceName string) (*entity.Route, error) {
+	uri, err := url.Parse(service.Uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service uri: %w", err)
+	}
+
+	endpoints, err := parseEndpoints(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service urls: %w", err)
+	}
+
+	timeout, err := parseTimeout(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the timeout of the service `%s`: %w", serviceName, err)
+	}
+
+	weight, err := parseWeight(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the weight of the service `%s`: %w", serviceName, err)
+	}
+
+	pathPrefix, err := parsePathPrefix(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the path prefix of the service `%s`: %w", serviceName, err)
+	}
+
+	grpcMethods, err := parseGRPCMethods(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the gRPC methods of the service `%s`: %w", serviceName, err)
+	}
+
+	matcher, err := parseMatcher(service.Annotations, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the matcher of the service `%s`: %w", serviceName, err)
+	}
+
+	return &entity.Route{
+		Name:        serviceName,
+		Version:     fmt.Sprintf("%s-%d", service.Uid, service.Generation),
+		Host:        uri.Host,
+		Endpoints:   endpoints,
+		Matcher:     matcher,
+		Timeout:     timeout,
+		Weight:      weight,
+		PathPrefix:  pathPrefix,
+		GRPCMethods: grpcMethods,
+	}, nil
+}
+
+// newOriginService returns the origin service without its routes and version, which are resolved after all services are listed.
+func newOriginService(service *runpb.Service, serviceName string) (*entity.Service, error) {
+	uri, err := url.Parse(service.Uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service uri: %w", err)
+	}
+
+	endpoints, err := parseEndpoints(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service urls: %w", err)
+	}
+
+	timeout, err := parseTimeout(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the timeout of the service `%s`: %w", serviceName, err)
+	}
+
+	retryPolicy, err := parseRetryPolicy(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the retry policy of the service `%s`: %w", serviceName, err)
+	}
+
+	hedgePolicy, err := parseHedgePolicy(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the hedge policy of the service `%s`: %w", serviceName, err)
+	}
+
+	headerMutation, err := parseHeaderMutation(service.Annotations, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the header mutation of the service `%s`: %w", serviceName, err)
+	}
+
+	aliases, err := parseAliases(service.Annotations, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the aliases of the service `%s`: %w", serviceName, err)
+	}
+
+	visibleTo, err := parseVisibleTo(service.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the client groups of the service `%s`: %w", serviceName, err)
+	}
+
+	return &entity.Service{
+		Name:      serviceName,
+		Aliases:   aliases,
+		VisibleTo: visibleTo,
+		DefaultRoute: &entity.Route{
+			Name:           serviceName,
+			Host:           uri.Host,
+			Endpoints:      endpoints,
+			Version:        fmt.Sprintf("%s-%d", service.Uid, service.Generation),
+			Timeout:        timeout,
+			RetryPolicy:    retryPolicy,
+			HedgePolicy:    hedgePolicy,
+			HeaderMutation: headerMutation,
+		},
+	}, nil
+}
+
+// parseRoutePolicies sets the policies of the route parsed from the annotations merged with the inheritable annotations of its origin service.
+func parseRoutePolicies(r *entity.Route, annotations map[string]string) error {
+	var err error
+
+	r.RetryPolicy, err = parseRetryPolicy(annotations)
+	if err != nil {
+		return fmt.Errorf("failed to parse the retry policy of the service `%s`: %w", r.Name, err)
+	}
+
+	r.HedgePolicy, err = parseHedgePolicy(annotations)
+	if err != nil {
+		return fmt.Errorf("failed to parse the hedge policy of the service `%s`: %w", r.Name, err)
+	}
+
+	r.HeaderMutation, err = parseHeaderMutation(annotations, r.Name)
+	if err != nil {
+		return fmt.Errorf("failed to parse the header mutation of the service `%s`: %w", r.Name, err)
+	}
 
 	return nil
 }
+
+// nameCollision is the service whose name has been qualified since a service in the preceding parents has already taken the name.
+type nameCollision struct {
+	name          string
+	qualifiedName string
+	parent        parent
+}
+
+// mergeServices merges the services listed from the parents, which are in the same order as the parents, into the map keyed by the service names.
+// Each service is keyed by its name unless a service in the preceding parents has already taken it.
+// Otherwise, the name is qualified by the location like `<name>.<location>`,
+// and also by the project like `<name>.<location>.<project>` if the location-qualified name has been taken as well.
+// Since names of Cloud Run services cannot contain dots, the qualified names never collide with the names of other services.
+// The listed services are copied instead of being renamed so that they can be merged again on the next refresh, and the qualified names are returned.
+func mergeServices(parents []parent, results [][]*entity.Service) (map[string]*entity.Service, []nameCollision) {
+	servicesMap := make(map[string]*entity.Service)
+
+	var collisions []nameCollision
+
+	for i, services := range results {
+		for _, service := range services {
+			key := service.Name
+
+			if _, ok := servicesMap[key]; ok {
+				key = fmt.Sprintf("%s.%s", service.Name, parents[i].location)
+			}
+
+			if _, ok := servicesMap[key]; ok {
+				key = fmt.Sprintf("%s.%s.%s", service.Name, parents[i].location, parents[i].project)
+			}
+
+			if key != service.Name {
+				collisions = append(collisions, nameCollision{name: service.Name, qualifiedName: key, parent: parents[i]})
+			}
+
+			merged := *service
+			merged.Name = key
+			servicesMap[key] = &merged
+		}
+	}
+
+	return servicesMap, collisions
+}
+
+// removeConflictingAliases removes the aliases which are same as the name or an alias of another service,
+// since clients cannot decide which service the alias refers to. The services are visited in the order of their names,
+// so the service which comes first keeps a shared alias. It returns the errors which describe the removed aliases.
+func removeConflictingAliases(servicesMap map[string]*entity.Service) []error {
+	aliasToServiceMap := make(map[string]string)
+
+	var errs []error
+
+	for _, name := range slices.Sorted(maps.Keys(servicesMap)) {
+		service := servicesMap[name]
+
+		var aliases []string
+		for _, a := range service.Aliases {
+			if _, ok := servicesMap[a]; ok {
+				errs = append(errs, fmt.Errorf("the alias `%s` of the service `%s` is same as the name of another service", a, service.Name))
+				continue
+			}
+
+			if other, ok := aliasToServiceMap[a]; ok {
+				errs = append(errs, fmt.Errorf("the alias `%s` is used by both of the services `%s` and `%s`", a, other, service.Name))
+				continue
+			}
+
+			aliasToServiceMap[a] = service.Name
+			aliases = append(aliases, a)
+		}
+
+		if len(aliases) != len(service.Aliases) {
+			service.Aliases = aliases
+		}
+	}
+
+	return errs
+}
+
+// parseEndpoints returns the sorted unique hosts of all URLs of the service.
+func parseEndpoints(service *runpb.Service) ([]string, error) {
+	var endpoints []string
+	for _, u := range append([]string{service.Uri}, service.Urls...) {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the url `%s`: %w", u, err)
+		}
+
+		if parsed.Host == "" {
+			continue
+		}
+
+		endpoints = append(endpoints, parsed.Host)
+	}
+
+	sort.Strings(endpoints)
+
+	return lo.Uniq(endpoints), nil
+}
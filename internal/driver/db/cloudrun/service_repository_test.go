@@ -2,36 +2,63 @@ package cloudrun
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/run/apiv2/runpb"
+	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/repository"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
 )
 
 var (
 	_                 runpb.ServicesServer = (*testCloudRunServicesServer)(nil)
 	firstPageServices                      = []*runpb.Service{
 		{
-			Name:       "projects/test-project/locations/test-location/services/origin-service-1",
-			Uid:        "8748ff67-5f1c-4df1-b507-9cbb18950a07",
-			Uri:        "https://origin-service-1-test-an.a.run.app",
+			Name: "projects/test-project/locations/test-location/services/origin-service-1",
+			Uid:  "8748ff67-5f1c-4df1-b507-9cbb18950a07",
+			Uri:  "https://origin-service-1-test-an.a.run.app",
+			Urls: []string{
+				"https://origin-service-1-test-an.a.run.app",
+				"https://origin-service-1-123456789.test-location.run.app",
+			},
 			Generation: 1,
+			Template: &runpb.RevisionTemplate{
+				Timeout: durationpb.New(300 * time.Second),
+			},
+			Annotations: map[string]string{
+				hedgeOnPerTryTimeoutAnnotation:   "true",
+				requestHeadersToRemoveAnnotation: "X-Debug, x-internal,x-debug",
+			},
 		},
 		{
-			Name:        "projects/test-project/locations/test-location/services/route-service-1",
-			Uid:         "b6c2cda0-dd8c-40ed-af1e-86effe719ffc",
-			Uri:         "https://route-service-1-test-an.a.run.app",
-			Generation:  1,
-			Annotations: map[string]string{originServiceAnnotation: "origin-service-1"},
+			Name:       "projects/test-project/locations/test-location/services/route-service-1",
+			Uid:        "b6c2cda0-dd8c-40ed-af1e-86effe719ffc",
+			Uri:        "https://route-service-1-test-an.a.run.app",
+			Generation: 1,
+			Annotations: map[string]string{
+				originServiceAnnotation:  "origin-service-1",
+				queryParameterAnnotation: "route",
+				matchAnnotation:          "present",
+			},
 		},
 		{
 			Name:       "projects/test-project/locations/test-location/services/origin-service-without-route",
@@ -53,31 +80,85 @@ var (
 			Uid:        "b1a2cef0-b570-40b9-8de0-09966912bc0f",
 			Generation: 1,
 			Uri:        "https://origin-service-2-test-an.a.run.app",
+			Annotations: map[string]string{
+				headerAnnotation:                   "x-route",
+				retryOnAnnotation:                  "unavailable, cancelled",
+				retryNumRetriesAnnotation:          "3",
+				retryBackoffBaseIntervalAnnotation: "25ms",
+				servedByAnnotation:                 "true",
+				aliasesAnnotation:                  "origin-service-2:443, origin-service-2.internal,origin-service-2",
+			},
 		},
 		{
-			Name:        "projects/test-project/locations/test-location/services/route-service-2",
-			Uid:         "04c21e30-0f9e-401c-bc11-0e920428df27",
-			Generation:  1,
-			Uri:         "https://route-service-2-test-an.a.run.app",
-			Annotations: map[string]string{originServiceAnnotation: "origin-service-2"},
+			Name:       "projects/test-project/locations/test-location/services/route-service-2",
+			Uid:        "04c21e30-0f9e-401c-bc11-0e920428df27",
+			Generation: 1,
+			Uri:        "https://route-service-2-test-an.a.run.app",
+			Annotations: map[string]string{
+				originServiceAnnotation: "origin-service-2",
+				pathPrefixAnnotation:    "/pkg.Bar/",
+				grpcMethodsAnnotation:   "/pkg.Foo/Foo, /pkg.Foo/Bar,/pkg.Foo/Foo",
+				timeoutAnnotation:       "1h",
+			},
 		},
 		{
-			Name:        "projects/test-project/locations/test-location/services/route-service-3",
-			Uid:         "e1760a39-09fd-4f98-b842-a21413c367ca",
-			Generation:  1,
-			Uri:         "https://route-service-3-test-an.a.run.app",
-			Annotations: map[string]string{originServiceAnnotation: "origin-service-2"},
+			Name:       "projects/test-project/locations/test-location/services/route-service-3",
+			Uid:        "e1760a39-09fd-4f98-b842-a21413c367ca",
+			Generation: 1,
+			Uri:        "https://route-service-3-test-an.a.run.app",
+			Annotations: map[string]string{
+				originServiceAnnotation:             "origin-service-2",
+				weightAnnotation:                    "10",
+				matchAnnotation:                     "prefix:pr-",
+				retryNumRetriesAnnotation:           "5",
+				retryRetriableStatusCodesAnnotation: "503,502",
+				requestHeadersToAddAnnotation:       "X-Canary: true, x-env: pr",
+				servedByAnnotation:                  "false",
+			},
 		},
 	}
 )
 
 type testCloudRunServicesServer struct {
 	runpb.UnimplementedServicesServer
+
+	// flakyCalls is the number of calls for the flaky parent, which fails after the first call.
+	flakyCalls atomic.Int32
 }
 
 const testNextPageToken = "next-page-token"
 
 func (t *testCloudRunServicesServer) ListServices(ctx context.Context, req *runpb.ListServicesRequest) (*runpb.ListServicesResponse, error) {
+	switch req.Parent {
+	case "projects/test-project/locations/test-location":
+	case "projects/test-project/locations/other-location":
+		return &runpb.ListServicesResponse{Services: otherLocationServices}, nil
+	case "projects/other-project/locations/other-location":
+		return &runpb.ListServicesResponse{Services: otherProjectServices}, nil
+	case "projects/test-project/locations/labeled-location":
+		return &runpb.ListServicesResponse{Services: labeledServices}, nil
+	case "projects/test-project/locations/alias-location":
+		return &runpb.ListServicesResponse{Services: []*runpb.Service{
+			{
+				Name:        "projects/test-project/locations/alias-location/services/origin-service-4",
+				Uri:         "https://origin-service-4-test-al.a.run.app",
+				Annotations: map[string]string{aliasesAnnotation: "origin-service-1"},
+			},
+		}}, nil
+	case "projects/test-project/locations/invalid-location":
+		return &runpb.ListServicesResponse{Services: invalidAnnotationServices}, nil
+	case "projects/broken-project/locations/test-location":
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	case "projects/flaky-project/locations/other-location":
+		if t.flakyCalls.Add(1) > 1 {
+			return nil, status.Error(codes.PermissionDenied, "permission denied")
+		}
+
+		return &runpb.ListServicesResponse{Services: otherLocationServices}, nil
+	default:
+		return &runpb.ListServicesResponse{}, nil
+	}
+
 	var res *runpb.ListServicesResponse
 
 	if req.PageToken == "" {
@@ -95,6 +176,71 @@ func (t *testCloudRunServicesServer) ListServices(ctx context.Context, req *runp
 	return res, nil
 }
 
+var (
+	otherLocationServices = []*runpb.Service{
+		{
+			Name:       "projects/test-project/locations/other-location/services/origin-service-1",
+			Uid:        "3c1c8b2e-6f0a-4a43-9d47-1b1f0c2f7a1e",
+			Uri:        "https://origin-service-1-test-ol.a.run.app",
+			Generation: 1,
+		},
+		{
+			Name:        "projects/test-project/locations/other-location/services/route-service-1",
+			Uid:         "9a0e5f4d-2b8c-4d0e-8f6a-7c3b2a1d0e9f",
+			Uri:         "https://route-service-1-test-ol.a.run.app",
+			Generation:  1,
+			Annotations: map[string]string{originServiceAnnotation: "origin-service-1"},
+		},
+		{
+			Name:       "projects/test-project/locations/other-location/services/origin-service-3",
+			Uid:        "5e2d7c1b-0a9f-4e8d-b7c6-a5b4c3d2e1f0",
+			Uri:        "https://origin-service-3-test-ol.a.run.app",
+			Generation: 1,
+		},
+	}
+	otherProjectServices = []*runpb.Service{
+		{
+			Name:       "projects/other-project/locations/other-location/services/origin-service-1",
+			Uid:        "d4c3b2a1-f0e9-4d8c-a7b6-5e4d3c2b1a0f",
+			Uri:        "https://origin-service-1-other-ol.a.run.app",
+			Generation: 1,
+		},
+	}
+)
+
+var labeledServices = []*runpb.Service{
+	{
+		Name:       "projects/test-project/locations/labeled-location/services/payments",
+		Uid:        "0b9f3c2e-1d4a-4e6b-8c7d-9e0f1a2b3c4d",
+		Uri:        "https://payments-test-ll.a.run.app",
+		Generation: 1,
+		Labels:     map[string]string{"team": "payments"},
+	},
+	{
+		Name:        "projects/test-project/locations/labeled-location/services/payments-canary",
+		Uid:         "6a5b4c3d-2e1f-4a0b-9c8d-7e6f5a4b3c2d",
+		Uri:         "https://payments-canary-test-ll.a.run.app",
+		Generation:  1,
+		Labels:      map[string]string{"team": "payments", "routable": "true"},
+		Annotations: map[string]string{originServiceAnnotation: "payments"},
+	},
+	{
+		Name:        "projects/test-project/locations/labeled-location/services/payments-batch",
+		Uid:         "1f2e3d4c-5b6a-4978-8a9b-0c1d2e3f4a5b",
+		Uri:         "https://payments-batch-test-ll.a.run.app",
+		Generation:  1,
+		Labels:      map[string]string{"team": "payments", "routable": "false"},
+		Annotations: map[string]string{originServiceAnnotation: "payments"},
+	},
+	{
+		Name:       "projects/test-project/locations/labeled-location/services/search",
+		Uid:        "9d8c7b6a-5f4e-4d3c-b2a1-0f9e8d7c6b5a",
+		Uri:        "https://search-test-ll.a.run.app",
+		Generation: 1,
+		Labels:     map[string]string{"team": "search"},
+	},
+}
+
 var endpoint string
 
 func TestMain(m *testing.M) {
@@ -132,57 +278,168 @@ func TestMain(m *testing.M) {
 	}())
 }
 
+func newTestMetrics(t *testing.T) *telemetry.Metrics {
+	t.Helper()
+
+	m, err := telemetry.NewMetrics(func() map[string]int { return nil })
+	if err != nil {
+		t.Fatalf("failed to create the metrics: %s", err)
+	}
+
+	return m
+}
+
+// snapshotAge scrapes the seconds of the snapshot age from the metrics.
+func snapshotAge(t *testing.T, m *telemetry.Metrics) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		value, ok := strings.CutPrefix(line, "cloud_run_service_router_snapshot_age_seconds ")
+		if !ok {
+			continue
+		}
+
+		age, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("failed to parse the snapshot age: %s", err)
+		}
+
+		return age
+	}
+
+	t.Fatal("want the snapshot age, got nothing")
+
+	return 0
+}
+
 func TestRefreshServices(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 
-	repo, err := NewServiceRepository(ctx, "test-project", "test-location", endpoint)
+	repo, err := NewServiceRepository(ctx, []string{"test-project"}, []string{"test-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
 	if err != nil {
 		t.Errorf("failed to create the service repository: %s", err)
 		return
 	}
 
-	if err = repo.RefreshServices(ctx); err != nil {
+	sdiff, err := repo.RefreshServices(ctx)
+	if err != nil {
 		t.Errorf("failed to refresh services: %s", err)
 		return
 	}
 
+	if len(sdiff.Added) != 3 || len(sdiff.Removed) != 0 || len(sdiff.Updated) != 0 {
+		t.Errorf("want all services to be added on the first refresh, but got %d added, %d removed and %d updated", len(sdiff.Added), len(sdiff.Removed), len(sdiff.Updated))
+		return
+	}
+
 	want := []*entity.Service{
 		{
 			Name:    "origin-service-1",
 			Version: "b543a676722f1d45cdd5b7c4b9c4ce939cc14896e0251d36c789c9d812b65a89",
 			DefaultRoute: &entity.Route{
-				Name:    "origin-service-1",
-				Host:    "origin-service-1-test-an.a.run.app",
-				Version: "8748ff67-5f1c-4df1-b507-9cbb18950a07-1",
+				Name:      "origin-service-1",
+				Host:      "origin-service-1-test-an.a.run.app",
+				Endpoints: []string{"origin-service-1-123456789.test-location.run.app", "origin-service-1-test-an.a.run.app"},
+				Version:   "8748ff67-5f1c-4df1-b507-9cbb18950a07-1",
+				Timeout:   300 * time.Second,
+				HedgePolicy: &entity.HedgePolicy{
+					HedgeOnPerTryTimeout: true,
+				},
+				HeaderMutation: entity.HeaderMutation{
+					RequestHeadersToRemove: []string{"x-debug", "x-internal"},
+				},
 			},
 			Routes: map[string]*entity.Route{
 				"route-service-1": {
-					Name:    "route-service-1",
-					Host:    "route-service-1-test-an.a.run.app",
-					Version: "b6c2cda0-dd8c-40ed-af1e-86effe719ffc-1",
+					Name:      "route-service-1",
+					Host:      "route-service-1-test-an.a.run.app",
+					Endpoints: []string{"route-service-1-test-an.a.run.app"},
+					Version:   "b6c2cda0-dd8c-40ed-af1e-86effe719ffc-1",
+					Matcher: entity.Matcher{
+						Source: entity.MatcherSourceQueryParameter,
+						Name:   "route",
+						Kind:   entity.MatchKindPresent,
+					},
+					HedgePolicy: &entity.HedgePolicy{
+						HedgeOnPerTryTimeout: true,
+					},
+					HeaderMutation: entity.HeaderMutation{
+						RequestHeadersToRemove: []string{"x-debug", "x-internal"},
+					},
 				},
 			},
 		},
 		{
 			Name:    "origin-service-2",
-			Version: "9630692759893938f2f580f7f1add146279dab745e4a22f7c972f36c53c608bb",
+			Aliases: []string{"origin-service-2.internal", "origin-service-2:443"},
+			Version: "20f41aa3e5ce5aa3824c1159636156770868c3cfdddfe2a61733343578b68c6e",
 			DefaultRoute: &entity.Route{
-				Name:    "origin-service-2",
-				Host:    "origin-service-2-test-an.a.run.app",
-				Version: "b1a2cef0-b570-40b9-8de0-09966912bc0f-1",
+				Name:      "origin-service-2",
+				Host:      "origin-service-2-test-an.a.run.app",
+				Endpoints: []string{"origin-service-2-test-an.a.run.app"},
+				Version:   "b1a2cef0-b570-40b9-8de0-09966912bc0f-1",
+				RetryPolicy: &entity.RetryPolicy{
+					RetryOn:      []string{"cancelled", "unavailable"},
+					NumRetries:   3,
+					BaseInterval: 25 * time.Millisecond,
+				},
+				HeaderMutation: entity.HeaderMutation{
+					ResponseHeadersToAdd: []entity.Header{{Name: "x-cloud-run-service-router-served-by", Value: "origin-service-2"}},
+				},
 			},
 			Routes: map[string]*entity.Route{
 				"route-service-2": {
-					Name:    "route-service-2",
-					Host:    "route-service-2-test-an.a.run.app",
-					Version: "04c21e30-0f9e-401c-bc11-0e920428df27-1",
+					Name:      "route-service-2",
+					Host:      "route-service-2-test-an.a.run.app",
+					Endpoints: []string{"route-service-2-test-an.a.run.app"},
+					Version:   "04c21e30-0f9e-401c-bc11-0e920428df27-1",
+					Matcher: entity.Matcher{
+						Source: entity.MatcherSourceHeader,
+						Name:   "x-route",
+						Kind:   entity.MatchKindExact,
+						Value:  "route-service-2",
+					},
+					RetryPolicy: &entity.RetryPolicy{
+						RetryOn:      []string{"cancelled", "unavailable"},
+						NumRetries:   3,
+						BaseInterval: 25 * time.Millisecond,
+					},
+					HeaderMutation: entity.HeaderMutation{
+						ResponseHeadersToAdd: []entity.Header{{Name: "x-cloud-run-service-router-served-by", Value: "route-service-2"}},
+					},
+					Timeout:    time.Hour,
+					PathPrefix: "/pkg.Bar/",
+					GRPCMethods: []string{
+						"/pkg.Foo/Bar",
+						"/pkg.Foo/Foo",
+					},
 				},
 				"route-service-3": {
-					Name:    "route-service-3",
-					Host:    "route-service-3-test-an.a.run.app",
-					Version: "e1760a39-09fd-4f98-b842-a21413c367ca-1",
+					Name:      "route-service-3",
+					Host:      "route-service-3-test-an.a.run.app",
+					Endpoints: []string{"route-service-3-test-an.a.run.app"},
+					Version:   "e1760a39-09fd-4f98-b842-a21413c367ca-1",
+					Matcher: entity.Matcher{
+						Source: entity.MatcherSourceHeader,
+						Name:   "x-route",
+						Kind:   entity.MatchKindPrefix,
+						Value:  "pr-",
+					},
+					RetryPolicy: &entity.RetryPolicy{
+						RetryOn:              []string{"cancelled", "unavailable"},
+						NumRetries:           5,
+						BaseInterval:         25 * time.Millisecond,
+						RetriableStatusCodes: []uint32{502, 503},
+					},
+					HeaderMutation: entity.HeaderMutation{
+						RequestHeadersToAdd: []entity.Header{{Name: "x-canary", Value: "true"}, {Name: "x-env", Value: "pr"}},
+					},
+					Weight: 10,
 				},
 			},
 		},
@@ -190,9 +447,10 @@ func TestRefreshServices(t *testing.T) {
 			Name:    "origin-service-without-route",
 			Version: "a7928920b8b5fdab798afdb07a8a2e3795c0d932f2f42e0e4f34c27895357ffe",
 			DefaultRoute: &entity.Route{
-				Name:    "origin-service-without-route",
-				Host:    "origin-service-without-route-test-an.a.run.app",
-				Version: "1742dae4-4dfa-4061-8b90-727f25e5c6dd-1",
+				Name:      "origin-service-without-route",
+				Host:      "origin-service-without-route-test-an.a.run.app",
+				Endpoints: []string{"origin-service-without-route-test-an.a.run.app"},
+				Version:   "1742dae4-4dfa-4061-8b90-727f25e5c6dd-1",
 			},
 		},
 	}
@@ -207,5 +465,298 @@ func TestRefreshServices(t *testing.T) {
 		return strings.Compare(x.Name, y.Name) < 0
 	})); diff != "" {
 		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+
+	sdiff, err = repo.RefreshServices(ctx)
+	if err != nil {
+		t.Errorf("failed to refresh services: %s", err)
+		return
+	}
+
+	if !sdiff.IsEmpty() {
+		t.Errorf("want the empty diff since services have not changed, but got %+v", sdiff)
+	}
+
+	refreshedAt, err := repo.LastRefreshedAt(ctx)
+	if err != nil {
+		t.Errorf("failed to call LastRefreshedAt: %s", err)
+		return
+	}
+
+	if refreshedAt.IsZero() {
+		t.Error("want the time when services were refreshed, got zero")
+	}
+
+	service, err := repo.GetService(ctx, "origin-service-without-route")
+	if err != nil {
+		t.Errorf("failed to call GetService: %s", err)
+		return
+	}
+
+	if service.Name != "origin-service-without-route" {
+		t.Errorf("want origin-service-without-route, got %s", service.Name)
+	}
+
+	if _, err := repo.GetService(ctx, "route-service-1"); !errors.Is(err, repository.ErrServiceNotFound) {
+		t.Errorf("want %v, got %v", repository.ErrServiceNotFound, err)
+	}
+}
+
+func TestRefreshServices_MultipleParents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project", "other-project"}, []string{"test-location", "other-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	if _, err = repo.RefreshServices(ctx); err != nil {
+		t.Errorf("failed to refresh services: %s", err)
+		return
+	}
+
+	services, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	got := make(map[string][]string, len(services))
+	for _, s := range services {
+		hosts := []string{s.DefaultRoute.Host}
+		for _, r := range s.Routes {
+			hosts = append(hosts, r.Host)
+		}
+
+		got[s.Name] = hosts
+	}
+
+	want := map[string][]string{
+		"origin-service-1":                              {"origin-service-1-test-an.a.run.app", "route-service-1-test-an.a.run.app"},
+		"origin-service-1.other-location":               {"origin-service-1-test-ol.a.run.app", "route-service-1-test-ol.a.run.app"},
+		"origin-service-1.other-location.other-project": {"origin-service-1-other-ol.a.run.app"},
+		"origin-service-2":                              {"origin-service-2-test-an.a.run.app", "route-service-2-test-an.a.run.app", "route-service-3-test-an.a.run.app"},
+		"origin-service-3":                              {"origin-service-3-test-ol.a.run.app"},
+		"origin-service-without-route":                  {"origin-service-without-route-test-an.a.run.app"},
+	}
+
+	if diff := cmp.Diff(got, want, cmpopts.SortSlices(func(x, y string) bool {
+		return strings.Compare(x, y) < 0
+	})); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
+
+func TestRefreshServices_FailedParent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project", "broken-project"}, []string{"test-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	diff, err := repo.RefreshServices(ctx)
+	if err == nil {
+		t.Error("want the error of the failed parent, but got nil")
+		return
+	}
+
+	if diff == nil {
+		t.Error("want the difference of the succeeded parent along with the error, but got nil")
+		return
+	}
+
+	services, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	got := make([]string, len(services))
+	for i, s := range services {
+		got[i] = s.Name
+	}
+
+	want := []string{"origin-service-1", "origin-service-2", "origin-service-without-route"}
+
+	if diff := cmp.Diff(got, want, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+
+	refreshedAt, err := repo.LastRefreshedAt(ctx)
+	if err != nil {
+		t.Errorf("failed to call LastRefreshedAt: %s", err)
+		return
+	}
+
+	if !refreshedAt.IsZero() {
+		t.Errorf("want the zero time since the services of a parent have never been refreshed, but got %s", refreshedAt)
+	}
+}
+
+func TestRefreshServices_AllParentsFailed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"broken-project"}, []string{"test-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	diff, err := repo.RefreshServices(ctx)
+	if err == nil {
+		t.Error("want the error since all parents have failed, but got nil")
+		return
+	}
+
+	if diff == nil || !diff.IsEmpty() {
+		t.Errorf("want the empty difference along with the error, but got %+v", diff)
+	}
+}
+
+func TestRefreshServices_KeepServicesOfFailedParent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	metrics := newTestMetrics(t)
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project", "flaky-project"}, []string{"other-location"}, "cloud-run-service-router-", "", endpoint, metrics, logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	if _, err = repo.RefreshServices(ctx); err != nil {
+		t.Errorf("failed to refresh services: %s", err)
+		return
+	}
+
+	want, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	refreshedAt, err := repo.LastRefreshedAt(ctx)
+	if err != nil {
+		t.Errorf("failed to call LastRefreshedAt: %s", err)
+		return
+	}
+
+	const interval = 100 * time.Millisecond
+	time.Sleep(interval)
+
+	// NOTE: the flaky parent fails from the second refresh.
+	diff, err := repo.RefreshServices(ctx)
+	if err == nil {
+		t.Error("want the error of the failed parent, but got nil")
+		return
+	}
+
+	if !diff.IsEmpty() {
+		t.Errorf("want no difference since the services of the failed parent are kept, but got %+v", diff)
+	}
+
+	got, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	sortServices := cmpopts.SortSlices(func(x, y *entity.Service) bool { return x.Name < y.Name })
+	if diff := cmp.Diff(got, want, sortServices); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+
+	lastRefreshedAt, err := repo.LastRefreshedAt(ctx)
+	if err != nil {
+		t.Errorf("failed to call LastRefreshedAt: %s", err)
+		return
+	}
+
+	if !lastRefreshedAt.Equal(refreshedAt) {
+		t.Errorf("want %s since the refresh has partially failed, got %s", refreshedAt, lastRefreshedAt)
+	}
+
+	if age := snapshotAge(t, metrics); age < interval.Seconds() {
+		t.Errorf("want the snapshot age not to be reset by the partially failed refresh, got %v seconds", age)
+	}
+}
+
+func TestRefreshServices_ServiceSelector(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project"}, []string{"labeled-location"}, "cloud-run-service-router-", "team=payments,routable!=false", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	if _, err = repo.RefreshServices(ctx); err != nil {
+		t.Errorf("failed to refresh services: %s", err)
+		return
+	}
+
+	services, err := repo.ListAllServices(ctx)
+	if err != nil {
+		t.Errorf("failed to call ListAllServices: %s", err)
+		return
+	}
+
+	if len(services) != 1 {
+		t.Errorf("want only the service `payments`, but got %d services", len(services))
+		return
+	}
+
+	got := []string{services[0].Name}
+	for name := range services[0].Routes {
+		got = append(got, name)
+	}
+
+	if diff := cmp.Diff(got, []string{"payments", "payments-canary"}); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
+
+func TestRefreshServices_AliasCollision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo, err := NewServiceRepository(ctx, []string{"test-project"}, []string{"test-location", "alias-location"}, "cloud-run-service-router-", "", endpoint, newTestMetrics(t), logr.Discard())
+	if err != nil {
+		t.Errorf("failed to create the service repository: %s", err)
+		return
+	}
+
+	if _, err := repo.RefreshServices(ctx); err != nil {
+		t.Errorf("failed to refresh services: %s", err)
+		return
+	}
+
+	service, err := repo.GetService(ctx, "origin-service-4")
+	if err != nil {
+		t.Errorf("failed to call GetService: %s", err)
+		return
+	}
+
+	if len(service.Aliases) != 0 {
+		t.Errorf("want the alias colliding with the service name to be removed, but got %v", service.Aliases)
+	}
+
+	if _, err := repo.GetService(ctx, "origin-service-1"); err != nil {
+		t.Errorf("want the service `origin-service-1` to be kept, but got %s", err)
 	}
 }
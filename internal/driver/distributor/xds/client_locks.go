@@ -0,0 +1,49 @@
+package xds
+
+import "sync"
+
+// clientLocks holds a lock for each client, so that the updates of the snapshot of a client are serialized
+// without blocking the updates of the other clients. The lock of a client is removed when nobody holds or waits for it.
+type clientLocks struct {
+	mu    sync.Mutex
+	locks map[string]*clientLock
+}
+
+type clientLock struct {
+	sync.Mutex
+
+	// refs is the number of the goroutines which hold or wait for the lock. It is guarded by clientLocks.mu.
+	refs int
+}
+
+func newClientLocks() *clientLocks {
+	return &clientLocks{
+		locks: make(map[string]*clientLock),
+	}
+}
+
+// lock locks the client and returns the function which unlocks it.
+func (l *clientLocks) lock(client string) func() {
+	l.mu.Lock()
+	cl, ok := l.locks[client]
+	if !ok {
+		cl = new(clientLock)
+		l.locks[client] = cl
+	}
+	cl.refs++
+	l.mu.Unlock()
+
+	cl.Lock()
+
+	return func() {
+		cl.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		cl.refs--
+		if cl.refs == 0 {
+			delete(l.locks, client)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package xds
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientLocks(t *testing.T) {
+	t.Parallel()
+
+	l := newClientLocks()
+
+	unlock := l.lock("client-1")
+
+	// NOTE: the lock of the other client must not be blocked by the lock of client-1.
+	l.lock("client-2")()
+
+	var (
+		mu     sync.Mutex
+		locked bool
+		wg     sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		defer l.lock("client-1")()
+
+		mu.Lock()
+		locked = true
+		mu.Unlock()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	if locked {
+		t.Error("want client-1 to be locked until it is unlocked, but it was locked twice")
+	}
+	mu.Unlock()
+
+	unlock()
+	wg.Wait()
+
+	if n := len(l.locks); n != 0 {
+		t.Errorf("want no locks after all of them are unlocked, got %d", n)
+	}
+}
@@ -3,129 +3,430 @@ package xds
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	// NOTE: the types embedded in resources as Any must be registered, so that the resources can be marshaled as JSON,
+	// e.g. by the REST version of xDS and by the admin API.
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
 	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
-	duration "github.com/golang/protobuf/ptypes/duration"
+	"github.com/go-logr/logr"
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/distributor"
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
 )
 
 var _ distributor.ServiceDistributor = (*ServiceDistributor)(nil)
 
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/driver/distributor/xds")
+
+// defaultRouteTimeout is the timeout of routes whose services do not have their own timeout.
+const defaultRouteTimeout = 10 * time.Second
+
+// httpProtocolOptionsName is the name of the typed extension protocol options with which Envoy negotiates the HTTP protocol with clusters.
+const httpProtocolOptionsName = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+
 type ServiceDistributor struct {
 	snapshotCache cache.SnapshotCache
 
-	clientListenersMu struct {
+	// eds is true if clusters are distributed as EDS clusters with ClusterLoadAssignments instead of LOGICAL_DNS clusters.
+	// Envoy always receives LOGICAL_DNS clusters since the endpoints of ClusterLoadAssignments are the hostnames of Cloud Run services,
+	// which Envoy does not resolve.
+	eds bool
+
+	// upstreamCABundle is the path to the CA bundle which Envoy uses to verify Cloud Run services. Empty means that the system trust store is used.
+	upstreamCABundle string
+
+	// proxylessCertificateProvider is the name of the certificate provider instance, defined in the bootstrap of proxyless gRPC clients, which verifies Cloud Run services.
+	proxylessCertificateProvider string
+
+	// concurrency is the maximum number of clients to which services are distributed concurrently.
+	concurrency int
+
+	metrics *telemetry.Metrics
+
+	// snapshotLocks serialize updates of the snapshot of each client since each update replaces only one resource type of the existing snapshot.
+	snapshotLocks *clientLocks
+
+	listenerSubscriptions *subscriptions
+	routeSubscriptions    *subscriptions
+	clusterSubscriptions  *subscriptions
+	endpointSubscriptions *subscriptions
+
+	clientAttributesMu struct {
 		sync.RWMutex
-		clientRequestedListeners map[string][]string
+		clients map[string]*entity.Client
 	}
 
-	clientClustersMu struct {
-		sync.RWMutex
-		clientRequestedClusters map[string][]string
+	// failedClientsMu holds the clients to which the last distribution failed or was skipped,
+	// so that the services are distributed to them again even if the services have not changed since then.
+	failedClientsMu struct {
+		sync.Mutex
+		clients map[string]struct{}
 	}
 }
 
-func NewServiceDistributor(sc cache.SnapshotCache) *ServiceDistributor {
+func NewServiceDistributor(sc cache.SnapshotCache, eds bool, upstreamCABundle string, proxylessCertificateProvider string, concurrency int, metrics *telemetry.Metrics) *ServiceDistributor {
 	d := &ServiceDistributor{
-		snapshotCache: sc,
+		snapshotCache:                sc,
+		metrics:                      metrics,
+		concurrency:                  concurrency,
+		eds:                          eds,
+		upstreamCABundle:             upstreamCABundle,
+		proxylessCertificateProvider: proxylessCertificateProvider,
+		listenerSubscriptions:        newSubscriptions(),
+		routeSubscriptions:           newSubscriptions(),
+		clusterSubscriptions:         newSubscriptions(),
+		endpointSubscriptions:        newSubscriptions(),
+		snapshotLocks:                newClientLocks(),
 	}
 
-	d.clientListenersMu.clientRequestedListeners = make(map[string][]string)
-	d.clientClustersMu.clientRequestedClusters = make(map[string][]string)
+	d.clientAttributesMu.clients = make(map[string]*entity.Client)
+	d.failedClientsMu.clients = make(map[string]struct{})
 
 	return d
 }
 
-func (d *ServiceDistributor) DistributeServices(ctx context.Context, services []*entity.Service) error {
-	d.clientListenersMu.RLock()
-	defer d.clientListenersMu.RUnlock()
-	for client, resourceNames := range d.clientListenersMu.clientRequestedListeners {
-		// TODO: should call concurrently
+func (d *ServiceDistributor) DistributeServices(ctx context.Context, services []*entity.Service) (*entity.DistributionResult, error) {
+	ctx, span := tracer.Start(ctx, "ServiceDistributor.DistributeServices")
+	defer span.End()
+
+	return d.distributeToClients(
+		ctx,
+		services,
+		d.listenerSubscriptions.all(),
+		d.routeSubscriptions.all(),
+		d.clusterSubscriptions.all(),
+		d.endpointSubscriptions.all(),
+	)
+}
+
+// DistributeChangedServices distributes the services only to the clients which request the resources of the changed services or all resources,
+// and to the clients to which the last distribution failed.
+func (d *ServiceDistributor) DistributeChangedServices(ctx context.Context, services []*entity.Service, diff *entity.ServiceDiff) (*entity.DistributionResult, error) {
+	ctx, span := tracer.Start(ctx, "ServiceDistributor.DistributeChangedServices")
+	defer span.End()
+
+	names := newChangedResourceNames(diff)
+	failed := d.failedClients()
+
+	return d.distributeToClients(
+		ctx,
+		services,
+		mergeSubscriptions(d.listenerSubscriptions.affected(names.listeners), d.listenerSubscriptions.only(failed)),
+		mergeSubscriptions(d.routeSubscriptions.affected(names.routes), d.routeSubscriptions.only(failed)),
+		mergeSubscriptions(d.clusterSubscriptions.affected(names.clusters), d.clusterSubscriptions.only(failed)),
+		mergeSubscriptions(d.endpointSubscriptions.affected(names.clusters), d.endpointSubscriptions.only(failed)),
+	)
+}
+
+// DistributeServicesToFailedClients distributes the services only to the clients to which the last distribution failed or was skipped.
+func (d *ServiceDistributor) DistributeServicesToFailedClients(ctx context.Context, services []*entity.Service) (*entity.DistributionResult, error) {
+	ctx, span := tracer.Start(ctx, "ServiceDistributor.DistributeServicesToFailedClients")
+	defer span.End()
+
+	failed := d.failedClients()
+	if len(failed) == 0 {
+		return &entity.DistributionResult{}, nil
+	}
+
+	return d.distributeToClients(
+		ctx,
+		services,
+		d.listenerSubscriptions.only(failed),
+		d.routeSubscriptions.only(failed),
+		d.clusterSubscriptions.only(failed),
+		d.endpointSubscriptions.only(failed),
+	)
+}
+
+// mergeSubscriptions adds the resource names requested by the clients in src to dst, and returns dst.
+func mergeSubscriptions(dst, src map[string][]string) map[string][]string {
+	for client, names := range src {
+		dst[client] = names
+	}
+
+	return dst
+}
+
+// failedClients returns a copy of the clients to which the last distribution failed or was skipped.
+func (d *ServiceDistributor) failedClients() map[string]struct{} {
+	d.failedClientsMu.Lock()
+	defer d.failedClientsMu.Unlock()
+
+	clients := make(map[string]struct{}, len(d.failedClientsMu.clients))
+	for client := range d.failedClientsMu.clients {
+		clients[client] = struct{}{}
+	}
+
+	return clients
+}
+
+// setClientFailed records whether the last distribution to the client failed or was skipped.
+func (d *ServiceDistributor) setClientFailed(client string, failed bool) {
+	d.failedClientsMu.Lock()
+	defer d.failedClientsMu.Unlock()
+
+	if failed {
+		d.failedClientsMu.clients[client] = struct{}{}
+		return
+	}
+
+	delete(d.failedClientsMu.clients, client)
+}
+
+// distributeToClients distributes the services to the clients, each of which is mapped to its requested resource names of each resource type.
+// The clients are distributed by the bounded number of workers, and a failure of a client does not stop the distribution to the other clients.
+// The clients which fail or are skipped are recorded so that the next distribution retries them.
+// The counts of the services and the clients are recorded on the span of the caller.
+func (d *ServiceDistributor) distributeToClients(ctx context.Context, services []*entity.Service, listeners, routes, clusters, endpoints map[string][]string) (*entity.DistributionResult, error) {
+	start := time.Now()
+
+	clients := make(map[string]struct{})
+	for _, m := range []map[string][]string{listeners, routes, clusters, endpoints} {
+		for client := range m {
+			clients[client] = struct{}{}
+		}
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("services.count", len(services)),
+		attribute.Int("clients.count", len(clients)),
+	)
+
+	queue := make(chan string)
+
+	var (
+		mu     sync.Mutex
+		result entity.DistributionResult
+		errs   []error
+		wg     sync.WaitGroup
+	)
+
+	for range min(d.concurrency, len(clients)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for client := range queue {
+				if ctx.Err() != nil {
+					d.setClientFailed(client, true)
+
+					mu.Lock()
+					result.Skipped++
+					mu.Unlock()
+					continue
+				}
+
+				err := d.distributeToClient(ctx, services, client, listeners, routes, clusters, endpoints)
+
+				d.setClientFailed(client, err != nil)
+
+				mu.Lock()
+				if err != nil {
+					result.Failed++
+					errs = append(errs, err)
+				} else {
+					result.Succeeded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for client := range clients {
+		queue <- client
+	}
+	close(queue)
+
+	wg.Wait()
+
+	d.metrics.ObserveDistribution(time.Since(start), &result)
+
+	span.SetAttributes(
+		attribute.Int("clients.succeeded", result.Succeeded),
+		attribute.Int("clients.failed", result.Failed),
+		attribute.Int("clients.skipped", result.Skipped),
+	)
+
+	if err := errors.Join(errs...); err != nil {
+		return &result, tracing.RecordError(span, fmt.Errorf("failed to distribute services to %d clients: %w", result.Failed, err))
+	}
+
+	return &result, nil
+}
+
+// distributeToClient distributes the resources of each type which the client requests, and returns the errors of all the types.
+func (d *ServiceDistributor) distributeToClient(ctx context.Context, services []*entity.Service, client string, listeners, routes, clusters, endpoints map[string][]string) error {
+	ctx, span := tracer.Start(ctx, "ServiceDistributor.distributeToClient", trace.WithAttributes(attribute.String("client", client)))
+	defer span.End()
+
+	var errs []error
+
+	if resourceNames, ok := listeners[client]; ok {
 		if err := d.DistributeServicesToClient(ctx, services, client, resourceNames); err != nil {
-			return fmt.Errorf("failed to distribute Listenres to the client:%q : %w", client, err)
+			errs = append(errs, fmt.Errorf("failed to distribute Listenres to the client:%q : %w", client, err))
 		}
 	}
 
-	d.clientClustersMu.RLock()
-	defer d.clientClustersMu.RUnlock()
-	for client, resourceNames := range d.clientClustersMu.clientRequestedClusters {
-		// TODO: should call concurrently
+	if resourceNames, ok := routes[client]; ok {
+		if err := d.DistributeRoutesToClient(ctx, services, client, resourceNames); err != nil {
+			errs = append(errs, fmt.Errorf("failed to distribute RouteConfigurations to the client:%q : %w", client, err))
+		}
+	}
+
+	if resourceNames, ok := clusters[client]; ok {
 		if err := d.DistributeClustersToClient(ctx, services, client, resourceNames); err != nil {
-			return fmt.Errorf("failed to distribute Clusters to the client:%q : %w", client, err)
+			errs = append(errs, fmt.Errorf("failed to distribute Clusters to the client:%q : %w", client, err))
 		}
 	}
 
+	if resourceNames, ok := endpoints[client]; ok {
+		if err := d.DistributeEndpointsToClient(ctx, services, client, resourceNames); err != nil {
+			errs = append(errs, fmt.Errorf("failed to distribute ClusterLoadAssignments to the client:%q : %w", client, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return tracing.RecordError(span, err)
+	}
+
 	return nil
 }
 
 func (d *ServiceDistributor) DistributeServicesToClient(ctx context.Context, services []*entity.Service, client string, resouceNames []string) error {
-	listeners, version, err := generateListeners(services, resouceNames)
-	if err != nil {
-		return fmt.Errorf("failed to generate Listeners: %w", err)
-	}
+	return d.distributeResourcesToClient(ctx, services, client, resource.ListenerType, resouceNames)
+}
 
-	out := &cache.Snapshot{}
+func (d *ServiceDistributor) DistributeRoutesToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error {
+	return d.distributeResourcesToClient(ctx, services, client, resource.RouteType, resourceNames)
+}
 
-	osc, err := d.snapshotCache.GetSnapshot(client)
-	if err == nil {
-		cv := osc.GetVersion(resource.ClusterType)
+func (d *ServiceDistributor) DistributeClustersToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error {
+	return d.distributeResourcesToClient(ctx, services, client, resource.ClusterType, resourceNames)
+}
 
-		var clusters []types.Resource
-		for _, v := range osc.GetResources(resource.ClusterType) {
-			clusters = append(clusters, v)
-		}
+func (d *ServiceDistributor) DistributeEndpointsToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error {
+	return d.distributeResourcesToClient(ctx, services, client, resource.EndpointType, resourceNames)
+}
+
+func (d *ServiceDistributor) distributeResourcesToClient(ctx context.Context, services []*entity.Service, client string, typeURL string, resourceNames []string) error {
+	resources, version, err := d.generateResources(services, d.clientAttributes(client), typeURL, resourceNames)
+	if err != nil {
+		return err
+	}
+
+	return d.setResources(ctx, client, typeURL, version, resources)
+}
 
-		out.Resources[cache.GetResponseType(resource.ClusterType)] = cache.NewResources(cv, clusters)
+// Fetch responds to the fetch request of the client with the resources generated for the request.
+// The snapshot is set to a throwaway cache instead of the shared one,
+// so that a fetch never overwrites the snapshot of a stream with the same node ID and leaves nothing behind once it is responded.
+func (d *ServiceDistributor) Fetch(ctx context.Context, services []*entity.Service, client *entity.Client, req *cache.Request) (cache.Response, error) {
+	resources, version, err := d.generateResources(services, client, req.GetTypeUrl(), req.GetResourceNames())
+	if err != nil {
+		return nil, err
 	}
 
-	out.Resources[cache.GetResponseType(resource.ListenerType)] = cache.NewResources(version, listeners)
+	snapshot := &cache.Snapshot{}
+	snapshot.Resources[cache.GetResponseType(req.GetTypeUrl())] = cache.NewResources(version, resources)
 
-	if err := d.snapshotCache.SetSnapshot(ctx, client, out); err != nil {
-		return fmt.Errorf("failed to create a snapshot cache to the client `%s`: %w", client, err)
+	sc := cache.NewSnapshotCache(false, cache.IDHash{}, &snapshotCacheLogger{logger: logr.Discard()})
+	if err := sc.SetSnapshot(ctx, client.ID, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to create a snapshot for the fetch client `%s`: %w", client.ID, err)
 	}
 
-	return nil
+	return sc.Fetch(ctx, req)
 }
 
-func (d *ServiceDistributor) DistributeClustersToClient(ctx context.Context, services []*entity.Service, client string, resourceNames []string) error {
-	clusters, version, err := generateClusters(services, resourceNames)
-	if err != nil {
-		return fmt.Errorf("failed to generate Clusters: %w", err)
+// generateResources returns the resources of the type which are requested by the client, and their version.
+func (d *ServiceDistributor) generateResources(services []*entity.Service, client *entity.Client, typeURL string, resourceNames []string) ([]types.Resource, string, error) {
+	services = visibleServices(services, client.Group)
+
+	switch typeURL {
+	case resource.ListenerType:
+		listeners, version, err := generateListeners(services, resourceNames)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate Listeners: %w", err)
+		}
+
+		return listeners, version, nil
+	case resource.RouteType:
+		routes, version, err := generateRouteConfigurations(services, resourceNames)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate RouteConfigurations: %w", err)
+		}
+
+		return routes, version, nil
+	case resource.ClusterType:
+		clusters, version, err := d.generateClusters(services, resourceNames, client)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate Clusters: %w", err)
+		}
+
+		return clusters, version, nil
+	case resource.EndpointType:
+		assignments, version, err := generateClusterLoadAssignments(services, resourceNames)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate ClusterLoadAssignments: %w", err)
+		}
+
+		return assignments, version, nil
+	default:
+		return nil, "", fmt.Errorf("the type `%s` is not supported", typeURL)
 	}
+}
+
+// setResources replaces the resources of the type in the snapshot of the client, keeping the resources of other types.
+func (d *ServiceDistributor) setResources(ctx context.Context, client string, typeURL string, version string, resources []types.Resource) error {
+	defer d.snapshotLocks.lock(client)()
 
 	out := &cache.Snapshot{}
 
 	osc, err := d.snapshotCache.GetSnapshot(client)
 	if err == nil {
-		lv := osc.GetVersion(resource.ListenerType)
+		for _, t := range []string{resource.ListenerType, resource.RouteType, resource.ClusterType, resource.EndpointType} {
+			if t == typeURL {
+				continue
+			}
 
-		var listeners []types.Resource
-		for _, v := range osc.GetResources(resource.ListenerType) {
-			listeners = append(listeners, v)
-		}
+			var rs []types.Resource
+			for _, v := range osc.GetResources(t) {
+				rs = append(rs, v)
+			}
 
-		out.Resources[cache.GetResponseType(resource.ListenerType)] = cache.NewResources(lv, listeners)
+			out.Resources[cache.GetResponseType(t)] = cache.NewResources(osc.GetVersion(t), rs)
+		}
 	}
 
-	out.Resources[cache.GetResponseType(resource.ClusterType)] = cache.NewResources(version, clusters)
+	out.Resources[cache.GetResponseType(typeURL)] = cache.NewResources(version, resources)
 
 	if err := d.snapshotCache.SetSnapshot(ctx, client, out); err != nil {
 		return fmt.Errorf("failed to create a snapshot cache to the client `%s`: %w", client, err)
@@ -135,17 +436,79 @@ func (d *ServiceDistributor) DistributeClustersToClient(ctx context.Context, ser
 }
 
 func (d *ServiceDistributor) RegisterClient(ctx context.Context, client string, serviceNames []string) error {
-	d.clientListenersMu.Lock()
-	d.clientListenersMu.clientRequestedListeners[client] = serviceNames
-	defer d.clientListenersMu.Unlock()
+	d.listenerSubscriptions.register(client, serviceNames)
+
+	return nil
+}
+
+func (d *ServiceDistributor) RegisterRoutesToClient(ctx context.Context, client string, serviceNames []string) error {
+	d.routeSubscriptions.register(client, serviceNames)
 
 	return nil
 }
 
 func (d *ServiceDistributor) RegisterClustersToClient(ctx context.Context, client string, serviceNames []string) error {
-	d.clientClustersMu.Lock()
-	d.clientClustersMu.clientRequestedClusters[client] = serviceNames
-	defer d.clientClustersMu.Unlock()
+	d.clusterSubscriptions.register(client, serviceNames)
+
+	return nil
+}
+
+func (d *ServiceDistributor) RegisterClientAttributes(ctx context.Context, client *entity.Client) error {
+	d.clientAttributesMu.Lock()
+	d.clientAttributesMu.clients[client.ID] = client
+	defer d.clientAttributesMu.Unlock()
+
+	return nil
+}
+
+// UnregisterClient removes the resource names requested by the client and its attributes, and clears its snapshot.
+func (d *ServiceDistributor) UnregisterClient(ctx context.Context, client string) error {
+	d.listenerSubscriptions.unregister(client)
+	d.routeSubscriptions.unregister(client)
+	d.clusterSubscriptions.unregister(client)
+	d.endpointSubscriptions.unregister(client)
+
+	d.clientAttributesMu.Lock()
+	delete(d.clientAttributesMu.clients, client)
+	d.clientAttributesMu.Unlock()
+
+	d.setClientFailed(client, false)
+
+	// NOTE: the lock of the client is held so that the snapshot is not cleared in the middle of the update of the snapshot.
+	defer d.snapshotLocks.lock(client)()
+
+	d.snapshotCache.ClearSnapshot(client)
+
+	return nil
+}
+
+// clientAttributes returns the attributes registered for the client, or the client without any attributes if nothing is registered.
+func (d *ServiceDistributor) clientAttributes(client string) *entity.Client {
+	d.clientAttributesMu.RLock()
+	defer d.clientAttributesMu.RUnlock()
+
+	if c, ok := d.clientAttributesMu.clients[client]; ok {
+		return c
+	}
+
+	return &entity.Client{ID: client}
+}
+
+// visibleServices returns the services which are visible to the group of the client,
+// so that the resources of the other services are never distributed to the client even if it requests them by name.
+func visibleServices(services []*entity.Service, group string) []*entity.Service {
+	visible := make([]*entity.Service, 0, len(services))
+	for _, s := range services {
+		if s.IsVisibleTo(group) {
+			visible = append(visible, s)
+		}
+	}
+
+	return visible
+}
+
+func (d *ServiceDistributor) RegisterEndpointsToClient(ctx context.Context, client string, clusterNames []string) error {
+	d.endpointSubscriptions.register(client, clusterNames)
 
 	return nil
 }
@@ -164,137 +527,556 @@ func generateListeners(services []*entity.Service, requestedNames []string) ([]t
 		names[name] = struct{}{}
 	}
 
-	sort.SliceStable(services, func(i, j int) bool {
-		return strings.Compare(services[i].Name, services[j].Name) < 0
-	})
+	services = sortServices(services)
 
 	versionHash := sha256.New()
 
 	for _, service := range services {
-		_, ok := names[service.Name]
-		if !shoudDistributeAll && !ok {
-			continue
+		// NOTE: the listeners of the aliases share the RouteConfiguration of the service.
+		for _, name := range append([]string{service.Name}, service.Aliases...) {
+			_, ok := names[name]
+			if !shoudDistributeAll && !ok {
+				continue
+			}
+
+			lis, err := newListener(name, service.Name)
+			if err != nil {
+				return nil, "", err
+			}
+
+			listeners = append(listeners, lis)
+
+			// NOTE: the name of the RouteConfiguration is also written since the service which an alias refers to can be changed.
+			_, err = io.WriteString(versionHash, lis.Name+"/"+service.Name)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to write string to version has for listner/%q: %w", lis.Name, err)
+			}
 		}
+	}
 
-		var routes []*route.Route
+	return listeners, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+}
 
-		i := 0
-		for _, r := range service.Routes {
-			routes = append(routes, &route.Route{
-				Name: r.Name,
-				Match: &route.RouteMatch{
-					PathSpecifier: &route.RouteMatch_Prefix{
-						Prefix: "/",
-					},
-					Headers: []*route.HeaderMatcher{
-						{
-							Name: fmt.Sprintf("cloud-run-service-router-%s", service.Name), // TODO: This header prefix should be configurable.
-							HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{
-								ExactMatch: r.Name,
-							},
-						},
+// newListener returns the API listener which refers to the RouteConfiguration.
+func newListener(name string, routeConfigName string) (*listener.Listener, error) {
+	hc := &hcm.HttpConnectionManager{
+		HttpFilters: []*hcm.HttpFilter{
+			{
+				Name: "envoy.filters.http.router",
+				ConfigType: &hcm.HttpFilter_TypedConfig{
+					TypedConfig: &anypb.Any{
+						TypeUrl: "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
 					},
 				},
-				Action: &route.Route_Route{
-					Route: &route.RouteAction{
-						HostRewriteSpecifier: &route.RouteAction_AutoHostRewrite{
-							AutoHostRewrite: &wrappers.BoolValue{
-								Value: true,
-							},
-						},
-						ClusterSpecifier: &route.RouteAction_Cluster{
-							Cluster: r.Host,
-						},
-						Timeout: &duration.Duration{Seconds: 10}, // TODO: This timeout duration should be configurable.
+			},
+		},
+		RouteSpecifier: &hcm.HttpConnectionManager_Rds{
+			Rds: &hcm.Rds{
+				ConfigSource: &core.ConfigSource{
+					ResourceApiVersion: core.ApiVersion_V3,
+					ConfigSourceSpecifier: &core.ConfigSource_Ads{
+						Ads: &core.AggregatedConfigSource{},
 					},
 				},
-			})
+				RouteConfigName: routeConfigName,
+			},
+		},
+	}
+
+	hcb, err := proto.Marshal(hc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal a HttpConnectionManager protobuf: %w", err)
+	}
+
+	return &listener.Listener{
+		Name: name,
+		ApiListener: &listener.ApiListener{
+			ApiListener: &anypb.Any{
+				TypeUrl: "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+				Value:   hcb,
+			},
+		},
+	}, nil
+}
+
+func generateRouteConfigurations(services []*entity.Service, requestedNames []string) ([]types.Resource, string, error) {
+	if len(services) == 0 {
+		return []types.Resource{}, "", nil
+	}
+
+	var routeConfigurations []types.Resource
+
+	shoudDistributeAll := len(requestedNames) == 0
+
+	names := make(map[string]struct{})
+	for _, name := range requestedNames {
+		names[name] = struct{}{}
+	}
 
-			i++
+	services = sortServices(services)
+
+	versionHash := sha256.New()
+
+	for _, service := range services {
+		_, ok := names[service.Name]
+		if !shoudDistributeAll && !ok {
+			continue
 		}
 
-		sort.SliceStable(routes, func(x, y int) bool {
-			return strings.Compare(routes[x].Name, routes[y].Name) < 0
-		})
+		rc := generateRouteConfiguration(service)
 
-		routes = append(routes, &route.Route{
-			Name: service.Name,
-			Match: &route.RouteMatch{
-				PathSpecifier: &route.RouteMatch_Prefix{
-					Prefix: "/",
-				},
+		rcb, err := proto.MarshalOptions{Deterministic: true}.Marshal(rc)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal a RouteConfiguration protobuf: %w", err)
+		}
+
+		routeConfigurations = append(routeConfigurations, rc)
+
+		// NOTE: the RouteConfiguration itself is written to the version hash so that changes of routes (e.g. weights) are distributed.
+		_, err = versionHash.Write(rcb)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to write the RouteConfiguration to version hash for route/%q: %w", rc.Name, err)
+		}
+	}
+
+	return routeConfigurations, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+}
+
+// generateRouteConfiguration returns the RouteConfiguration of the service which is referred by the Listener with the same name.
+func generateRouteConfiguration(service *entity.Service) *route.RouteConfiguration {
+	var routes []*route.Route
+	var pathRoutes []*route.Route
+
+	for _, r := range service.Routes {
+		routes = append(routes, newRoute(r, newRouteMatch(r.Matcher)))
+
+		pathRoutes = append(pathRoutes, generatePathRoutes(r)...)
+	}
+
+	sort.SliceStable(routes, func(x, y int) bool {
+		return strings.Compare(routes[x].Name, routes[y].Name) < 0
+	})
+
+	sortPathRoutes(pathRoutes)
+
+	// NOTE: the header-matched routes take precedence over the path-matched routes so that clients can always pin their requests by the header.
+	routes = append(routes, pathRoutes...)
+
+	defaultRoute := newRoute(service.DefaultRoute, &route.RouteMatch{
+		PathSpecifier: &route.RouteMatch_Prefix{
+			Prefix: "/",
+		},
+	})
+
+	if wc := generateWeightedClusters(service); wc != nil {
+		defaultRoute.GetRoute().ClusterSpecifier = &route.RouteAction_WeightedClusters{
+			WeightedClusters: wc,
+		}
+
+		// NOTE: the headers are mutated by each weighted cluster so that they reflect the service which actually handles the request.
+		// On the other hand, the timeout and the retry and hedge policies of the origin service apply to all weighted clusters,
+		// since Envoy has them only per route. The policies of the route services apply only to the requests matched by the routes.
+		defaultRoute.RequestHeadersToAdd = nil
+		defaultRoute.RequestHeadersToRemove = nil
+		defaultRoute.ResponseHeadersToAdd = nil
+		defaultRoute.ResponseHeadersToRemove = nil
+	}
+
+	routes = append(routes, defaultRoute)
+
+	return &route.RouteConfiguration{
+		Name: service.Name,
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    service.Name,
+				Domains: append([]string{service.Name}, service.Aliases...),
+				Routes:  routes,
 			},
-			Action: &route.Route_Route{
-				Route: &route.RouteAction{
-					HostRewriteSpecifier: &route.RouteAction_AutoHostRewrite{
-						AutoHostRewrite: &wrappers.BoolValue{
-							Value: true,
-						},
-					},
-					ClusterSpecifier: &route.RouteAction_Cluster{
-						Cluster: service.DefaultRoute.Host,
-					},
-					Timeout: &duration.Duration{Seconds: 10}, // TODO: This timeout duration should be configurable.
+		},
+	}
+}
+
+func newRouteMatch(m entity.Matcher) *route.RouteMatch {
+	match := &route.RouteMatch{
+		PathSpecifier: &route.RouteMatch_Prefix{
+			Prefix: "/",
+		},
+	}
+
+	switch m.Source {
+	case entity.MatcherSourceHeader:
+		hm := &route.HeaderMatcher{
+			Name: m.Name,
+		}
+
+		switch m.Kind {
+		case entity.MatchKindExact:
+			hm.HeaderMatchSpecifier = &route.HeaderMatcher_ExactMatch{
+				ExactMatch: m.Value,
+			}
+		case entity.MatchKindPrefix:
+			hm.HeaderMatchSpecifier = &route.HeaderMatcher_PrefixMatch{
+				PrefixMatch: m.Value,
+			}
+		case entity.MatchKindSafeRegex:
+			hm.HeaderMatchSpecifier = &route.HeaderMatcher_SafeRegexMatch{
+				SafeRegexMatch: &matcher.RegexMatcher{
+					Regex: m.Value,
 				},
-			},
-		})
+			}
+		case entity.MatchKindPresent:
+			hm.HeaderMatchSpecifier = &route.HeaderMatcher_PresentMatch{
+				PresentMatch: true,
+			}
+		}
 
-		hc := &hcm.HttpConnectionManager{
-			HttpFilters: []*hcm.HttpFilter{
-				{
-					Name: "envoy.filters.http.router",
-					ConfigType: &hcm.HttpFilter_TypedConfig{
-						TypedConfig: &anypb.Any{
-							TypeUrl: "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
-						},
+		match.Headers = []*route.HeaderMatcher{hm}
+	case entity.MatcherSourceQueryParameter:
+		qm := &route.QueryParameterMatcher{
+			Name: m.Name,
+		}
+
+		switch m.Kind {
+		case entity.MatchKindExact:
+			qm.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{
+					MatchPattern: &matcher.StringMatcher_Exact{
+						Exact: m.Value,
 					},
 				},
-			},
-			RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{
-				RouteConfig: &route.RouteConfiguration{
-					VirtualHosts: []*route.VirtualHost{
-						{
-							Name:    service.Name,
-							Domains: []string{service.Name},
-							Routes:  routes,
+			}
+		case entity.MatchKindPrefix:
+			qm.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{
+					MatchPattern: &matcher.StringMatcher_Prefix{
+						Prefix: m.Value,
+					},
+				},
+			}
+		case entity.MatchKindSafeRegex:
+			qm.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_StringMatch{
+				StringMatch: &matcher.StringMatcher{
+					MatchPattern: &matcher.StringMatcher_SafeRegex{
+						SafeRegex: &matcher.RegexMatcher{
+							Regex: m.Value,
 						},
 					},
 				},
+			}
+		case entity.MatchKindPresent:
+			qm.QueryParameterMatchSpecifier = &route.QueryParameterMatcher_PresentMatch{
+				PresentMatch: true,
+			}
+		}
+
+		match.QueryParameters = []*route.QueryParameterMatcher{qm}
+	}
+
+	return match
+}
+
+// newRoute returns the route which sends the matched requests to the route entity with its header mutation.
+func newRoute(r *entity.Route, match *route.RouteMatch) *route.Route {
+	return &route.Route{
+		Name:  r.Name,
+		Match: match,
+		Action: &route.Route_Route{
+			Route: newRouteAction(r),
+		},
+		RequestHeadersToAdd:     newHeaderValueOptions(r.HeaderMutation.RequestHeadersToAdd),
+		RequestHeadersToRemove:  r.HeaderMutation.RequestHeadersToRemove,
+		ResponseHeadersToAdd:    newHeaderValueOptions(r.HeaderMutation.ResponseHeadersToAdd),
+		ResponseHeadersToRemove: r.HeaderMutation.ResponseHeadersToRemove,
+	}
+}
+
+func newClusterWeight(r *entity.Route, weight uint32) *route.WeightedCluster_ClusterWeight {
+	return &route.WeightedCluster_ClusterWeight{
+		Name:                    r.Host,
+		Weight:                  &wrappers.UInt32Value{Value: weight},
+		RequestHeadersToAdd:     newHeaderValueOptions(r.HeaderMutation.RequestHeadersToAdd),
+		RequestHeadersToRemove:  r.HeaderMutation.RequestHeadersToRemove,
+		ResponseHeadersToAdd:    newHeaderValueOptions(r.HeaderMutation.ResponseHeadersToAdd),
+		ResponseHeadersToRemove: r.HeaderMutation.ResponseHeadersToRemove,
+	}
+}
+
+func newHeaderValueOptions(headers []entity.Header) []*core.HeaderValueOption {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	options := make([]*core.HeaderValueOption, len(headers))
+	for i, h := range headers {
+		options[i] = &core.HeaderValueOption{
+			Header: &core.HeaderValue{
+				Key:   h.Name,
+				Value: h.Value,
 			},
+			AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
 		}
+	}
 
-		hcb, err := proto.Marshal(hc)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to marshal a HttpConnectionManager protobuf: %w", err)
+	return options
+}
+
+// newRouteAction returns the RouteAction which sends requests to the host of the route.
+// The timeout is used as both the request timeout and the max stream duration so that long-running streaming RPCs are not cut by the default timeout.
+func newRouteAction(r *entity.Route) *route.RouteAction {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = defaultRouteTimeout
+	}
+
+	return &route.RouteAction{
+		HostRewriteSpecifier: &route.RouteAction_AutoHostRewrite{
+			AutoHostRewrite: &wrappers.BoolValue{
+				Value: true,
+			},
+		},
+		ClusterSpecifier: &route.RouteAction_Cluster{
+			Cluster: r.Host,
+		},
+		Timeout: durationpb.New(timeout),
+		MaxStreamDuration: &route.RouteAction_MaxStreamDuration{
+			MaxStreamDuration: durationpb.New(timeout),
+		},
+		RetryPolicy: newRetryPolicy(r.RetryPolicy),
+		HedgePolicy: newHedgePolicy(r.HedgePolicy),
+	}
+}
+
+func newRetryPolicy(p *entity.RetryPolicy) *route.RetryPolicy {
+	if p == nil {
+		return nil
+	}
+
+	rp := &route.RetryPolicy{
+		RetryOn:              strings.Join(p.RetryOn, ","),
+		RetriableStatusCodes: p.RetriableStatusCodes,
+	}
+
+	if p.NumRetries != 0 {
+		rp.NumRetries = &wrappers.UInt32Value{Value: p.NumRetries}
+	}
+
+	if p.PerTryTimeout != 0 {
+		rp.PerTryTimeout = durationpb.New(p.PerTryTimeout)
+	}
+
+	if p.BaseInterval != 0 {
+		rp.RetryBackOff = &route.RetryPolicy_RetryBackOff{
+			BaseInterval: durationpb.New(p.BaseInterval),
 		}
 
-		lis := &listener.Listener{
-			Name: service.Name,
-			ApiListener: &listener.ApiListener{
-				ApiListener: &anypb.Any{
-					TypeUrl: "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
-					Value:   hcb,
-				},
+		if p.MaxInterval != 0 {
+			rp.RetryBackOff.MaxInterval = durationpb.New(p.MaxInterval)
+		}
+	}
+
+	return rp
+}
+
+func newHedgePolicy(p *entity.HedgePolicy) *route.HedgePolicy {
+	if p == nil {
+		return nil
+	}
+
+	hp := &route.HedgePolicy{
+		HedgeOnPerTryTimeout: p.HedgeOnPerTryTimeout,
+	}
+
+	if p.InitialRequests != 0 {
+		hp.InitialRequests = &wrappers.UInt32Value{Value: p.InitialRequests}
+	}
+
+	return hp
+}
+
+// generatePathRoutes returns routes which send requests for the gRPC methods and the path prefix claimed by the route regardless of headers.
+func generatePathRoutes(r *entity.Route) []*route.Route {
+	var routes []*route.Route
+
+	for _, method := range r.GRPCMethods {
+		routes = append(routes, newRoute(r, &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Path{
+				Path: method,
 			},
+		}))
+	}
+
+	if r.PathPrefix != "" {
+		routes = append(routes, newRoute(r, &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{
+				Prefix: r.PathPrefix,
+			},
+		}))
+	}
+
+	return routes
+}
+
+// sortPathRoutes sorts routes so that the exact path matches come first and then the longer path prefixes come before the shorter ones,
+// since the first matched route is chosen.
+func sortPathRoutes(routes []*route.Route) {
+	sort.SliceStable(routes, func(x, y int) bool {
+		xp, xIsPath := routes[x].Match.PathSpecifier.(*route.RouteMatch_Path)
+		yp, yIsPath := routes[y].Match.PathSpecifier.(*route.RouteMatch_Path)
+
+		switch {
+		case xIsPath && yIsPath:
+			return strings.Compare(xp.Path, yp.Path) < 0
+		case xIsPath:
+			return true
+		case yIsPath:
+			return false
 		}
 
-		listeners = append(listeners, lis)
-		_, err = io.WriteString(versionHash, lis.Name)
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to write string to version has for listner/%q: %w", lis.Name, err)
+		xPrefix := routes[x].Match.GetPrefix()
+		yPrefix := routes[y].Match.GetPrefix()
+
+		if len(xPrefix) != len(yPrefix) {
+			return len(xPrefix) > len(yPrefix)
+		}
+
+		return strings.Compare(xPrefix, yPrefix) < 0
+	})
+}
+
+// generateWeightedClusters returns the WeightedCluster which splits the traffic between the origin service and its routes that have weights.
+// It returns nil if none of the routes has a weight.
+func generateWeightedClusters(service *entity.Service) *route.WeightedCluster {
+	var weighted []*entity.Route
+	var totalWeight uint32
+	for _, r := range service.Routes {
+		if r.Weight == 0 {
+			continue
 		}
+
+		weighted = append(weighted, r)
+		totalWeight += r.Weight
 	}
 
-	return listeners, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+	if len(weighted) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return strings.Compare(weighted[i].Name, weighted[j].Name) < 0
+	})
+
+	var clusters []*route.WeightedCluster_ClusterWeight
+
+	if totalWeight < 100 {
+		clusters = append(clusters, newClusterWeight(service.DefaultRoute, 100-totalWeight))
+	}
+
+	for _, r := range weighted {
+		clusters = append(clusters, newClusterWeight(r, r.Weight))
+	}
+
+	return &route.WeightedCluster{
+		Clusters: clusters,
+	}
 }
 
-func generateClusters(services []*entity.Service, requestedNames []string) ([]types.Resource, string, error) {
+func (d *ServiceDistributor) generateClusters(services []*entity.Service, requestedNames []string, client *entity.Client) ([]types.Resource, string, error) {
 	if len(services) == 0 {
 		return []types.Resource{}, "", nil
 	}
 
 	var clusters []types.Resource
 
+	versionHash := sha256.New()
+
+	protocolOptions, err := newHTTPProtocolOptions()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, r := range selectClusterRoutes(services, requestedNames) {
+		var clu *cluster.Cluster
+		if d.eds && !client.Envoy {
+			clu = createEDSCluster(r.Host)
+		} else {
+			clu = createCluster(r.Host)
+		}
+
+		// NOTE: proxyless gRPC clients which have not opted in reject clusters with the transport socket,
+		// since they can verify the services only with the certificate provider instance.
+		if client.Envoy || client.ProxylessSecurity {
+			ts, err := d.newTransportSocket(r.Host, client.ProxylessSecurity)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to create the transport socket for cluster/%q: %w", clu.Name, err)
+			}
+
+			clu.TransportSocket = ts
+		}
+
+		clu.TypedExtensionProtocolOptions = map[string]*anypb.Any{
+			httpProtocolOptionsName: protocolOptions,
+		}
+
+		club, err := proto.MarshalOptions{Deterministic: true}.Marshal(clu)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal a Cluster protobuf: %w", err)
+		}
+
+		clusters = append(clusters, clu)
+
+		// NOTE: the Cluster itself is written to the version hash since its transport socket differs among clients.
+		_, err = versionHash.Write(club)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to write the Cluster to version hash for cluster/%q: %w", clu.Name, err)
+		}
+	}
+
+	return clusters, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+}
+
+func generateClusterLoadAssignments(services []*entity.Service, requestedNames []string) ([]types.Resource, string, error) {
+	if len(services) == 0 {
+		return []types.Resource{}, "", nil
+	}
+
+	var assignments []types.Resource
+
+	versionHash := sha256.New()
+
+	for _, r := range selectClusterRoutes(services, requestedNames) {
+		cla := createClusterLoadAssignment(r)
+
+		clab, err := proto.MarshalOptions{Deterministic: true}.Marshal(cla)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal a ClusterLoadAssignment protobuf: %w", err)
+		}
+
+		assignments = append(assignments, cla)
+
+		// NOTE: the ClusterLoadAssignment itself is written to the version hash so that changes of endpoints are distributed.
+		_, err = versionHash.Write(clab)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to write the ClusterLoadAssignment to version hash for endpoint/%q: %w", cla.ClusterName, err)
+		}
+	}
+
+	return assignments, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+}
+
+// sortServices returns a copy of the services sorted by their names.
+// NOTE: the services are copied since they are shared among the goroutines which distribute them to clients concurrently.
+func sortServices(services []*entity.Service) []*entity.Service {
+	sorted := slices.Clone(services)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Compare(sorted[i].Name, sorted[j].Name) < 0
+	})
+
+	return sorted
+}
+
+// selectClusterRoutes returns the routes whose hosts (cluster names) are requested, sorted by the service name and the route name.
+// All routes are returned if no name is requested.
+func selectClusterRoutes(services []*entity.Service, requestedNames []string) []*entity.Route {
 	shoudDistributeAll := len(requestedNames) == 0
 
 	names := make(map[string]struct{})
@@ -302,11 +1084,9 @@ func generateClusters(services []*entity.Service, requestedNames []string) ([]ty
 		names[name] = struct{}{}
 	}
 
-	sort.SliceStable(services, func(i, j int) bool {
-		return strings.Compare(services[i].Name, services[j].Name) < 0
-	})
+	services = sortServices(services)
 
-	versionHash := sha256.New()
+	var selected []*entity.Route
 
 	for _, service := range services {
 		var routes []*entity.Route
@@ -327,18 +1107,148 @@ func generateClusters(services []*entity.Service, requestedNames []string) ([]ty
 			return strings.Compare(routes[i].Name, routes[j].Name) < 0
 		})
 
-		for _, r := range routes {
-			clu := createCluster(r.Host)
-			clusters = append(clusters, clu)
+		selected = append(selected, routes...)
+	}
 
-			_, err := io.WriteString(versionHash, clu.Name)
-			if err != nil {
-				return nil, "", fmt.Errorf("failed to write string to version has for cluster/%q: %w", clu.Name, err)
-			}
+	return selected
+}
+
+// newHTTPProtocolOptions returns the HttpProtocolOptions with which Envoy negotiates HTTP/2 or HTTP/1.1 with Cloud Run services by ALPN.
+func newHTTPProtocolOptions() (*anypb.Any, error) {
+	a, err := anypb.New(&upstreamhttp.HttpProtocolOptions{
+		UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_AutoConfig{
+			AutoConfig: &upstreamhttp.HttpProtocolOptions_AutoHttpConfig{},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an any protobuf of the HttpProtocolOptions: %w", err)
+	}
+
+	return a, nil
+}
+
+// newTransportSocket returns the TLS transport socket to Cloud Run services, which verifies that the certificate is issued for the host.
+// Proxyless gRPC clients verify the services with the certificate provider instance in their bootstrap,
+// and Envoy verifies them with the CA bundle, or with the system trust store if the CA bundle is not configured.
+func (d *ServiceDistributor) newTransportSocket(host string, proxyless bool) (*core.TransportSocket, error) {
+	san := &matcher.StringMatcher{
+		MatchPattern: &matcher.StringMatcher_Exact{
+			Exact: host,
+		},
+	}
+
+	vc := &tls.CertificateValidationContext{
+		MatchTypedSubjectAltNames: []*tls.SubjectAltNameMatcher{
+			{
+				SanType: tls.SubjectAltNameMatcher_DNS,
+				Matcher: san,
+			},
+		},
+	}
+
+	switch {
+	case proxyless:
+		// NOTE: proxyless gRPC clients read only the deprecated field of the SAN matchers.
+		vc.MatchSubjectAltNames = []*matcher.StringMatcher{san}
+		vc.CaCertificateProviderInstance = &tls.CertificateProviderPluginInstance{
+			InstanceName: d.proxylessCertificateProvider,
+		}
+	case d.upstreamCABundle != "":
+		vc.TrustedCa = &core.DataSource{
+			Specifier: &core.DataSource_Filename{
+				Filename: d.upstreamCABundle,
+			},
 		}
+	default:
+		vc.SystemRootCerts = &tls.CertificateValidationContext_SystemRootCerts{}
 	}
 
-	return clusters, fmt.Sprintf("%x", versionHash.Sum(nil)), nil
+	ctx := &tls.UpstreamTlsContext{
+		Sni: host,
+		CommonTlsContext: &tls.CommonTlsContext{
+			AlpnProtocols: []string{"h2", "http/1.1"},
+			ValidationContextType: &tls.CommonTlsContext_ValidationContext{
+				ValidationContext: vc,
+			},
+		},
+	}
+
+	a, err := anypb.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an any protobuf of the UpstreamTlsContext: %w", err)
+	}
+
+	return &core.TransportSocket{
+		Name: "envoy.transport_sockets.tls",
+		ConfigType: &core.TransportSocket_TypedConfig{
+			TypedConfig: a,
+		},
+	}, nil
+}
+
+// createEDSCluster returns the cluster whose endpoints are distributed as the ClusterLoadAssignment with the same name via ADS.
+func createEDSCluster(host string) *cluster.Cluster {
+	return &cluster.Cluster{
+		Name: host,
+		ClusterDiscoveryType: &cluster.Cluster_Type{
+			Type: cluster.Cluster_EDS,
+		},
+		LbPolicy: cluster.Cluster_ROUND_ROBIN,
+		EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
+			EdsConfig: &core.ConfigSource{
+				ResourceApiVersion: core.ApiVersion_V3,
+				ConfigSourceSpecifier: &core.ConfigSource_Ads{
+					Ads: &core.AggregatedConfigSource{},
+				},
+			},
+			ServiceName: host,
+		},
+	}
+}
+
+// createClusterLoadAssignment returns the ClusterLoadAssignment which has all endpoints of the route.
+func createClusterLoadAssignment(r *entity.Route) *endpoint.ClusterLoadAssignment {
+	hosts := r.Endpoints
+	if len(hosts) == 0 {
+		hosts = []string{r.Host}
+	}
+
+	lbEndpoints := make([]*endpoint.LbEndpoint, len(hosts))
+	for i, h := range hosts {
+		lbEndpoints[i] = createLbEndpoint(h)
+	}
+
+	return &endpoint.ClusterLoadAssignment{
+		ClusterName: r.Host,
+		Endpoints: []*endpoint.LocalityLbEndpoints{
+			{
+				LbEndpoints: lbEndpoints,
+				LoadBalancingWeight: &wrappers.UInt32Value{
+					Value: 1,
+				},
+			},
+		},
+	}
+}
+
+func createLbEndpoint(host string) *endpoint.LbEndpoint {
+	return &endpoint.LbEndpoint{
+		HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+			Endpoint: &endpoint.Endpoint{
+				Hostname: host,
+				Address: &core.Address{
+					Address: &core.Address_SocketAddress{
+						SocketAddress: &core.SocketAddress{
+							Address: host,
+							PortSpecifier: &core.SocketAddress_PortValue{
+								PortValue: 443,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 func createCluster(host string) *cluster.Cluster {
@@ -353,23 +1263,7 @@ func createCluster(host string) *cluster.Cluster {
 			Endpoints: []*endpoint.LocalityLbEndpoints{
 				{
 					LbEndpoints: []*endpoint.LbEndpoint{
-						{
-							HostIdentifier: &endpoint.LbEndpoint_Endpoint{
-								Endpoint: &endpoint.Endpoint{
-									Hostname: host,
-									Address: &core.Address{
-										Address: &core.Address_SocketAddress{
-											SocketAddress: &core.SocketAddress{
-												Address: host,
-												PortSpecifier: &core.SocketAddress_PortValue{
-													PortValue: 443,
-												},
-											},
-										},
-									},
-								},
-							},
-						},
+						createLbEndpoint(host),
 					},
 				},
 			},
@@ -0,0 +1,1005 @@
+package xds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
+)
+
+// failingSnapshotCache fails to set snapshots of the specific clients.
+type failingSnapshotCache struct {
+	cache.SnapshotCache
+	failingClients map[string]struct{}
+}
+
+func (c *failingSnapshotCache) SetSnapshot(ctx context.Context, node string, snapshot cache.ResourceSnapshot) error {
+	if _, ok := c.failingClients[node]; ok {
+		return errors.New("failed to set the snapshot")
+	}
+
+	return c.SnapshotCache.SetSnapshot(ctx, node, snapshot)
+}
+
+func newTestMetrics(t *testing.T) *telemetry.Metrics {
+	t.Helper()
+
+	m, err := telemetry.NewMetrics(func() map[string]int { return nil })
+	if err != nil {
+		t.Fatalf("failed to create the metrics: %s", err)
+	}
+
+	return m
+}
+
+func TestDistributeServices(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		ctx            func() context.Context
+		failingClients map[string]struct{}
+		want           *entity.DistributionResult
+		wantErr        bool
+	}{
+		"should distribute services to all clients": {
+			ctx:  context.Background,
+			want: &entity.DistributionResult{Succeeded: 3},
+		},
+		"should distribute services to the other clients even if a client fails": {
+			ctx: context.Background,
+			failingClients: map[string]struct{}{
+				"client-2": {},
+			},
+			want:    &entity.DistributionResult{Succeeded: 2, Failed: 1},
+			wantErr: true,
+		},
+		"should skip all clients if the context has been canceled": {
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				return ctx
+			},
+			want: &entity.DistributionResult{Skipped: 3},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sc := &failingSnapshotCache{
+				SnapshotCache:  NewSnapshotCache(logr.Discard()),
+				failingClients: test.failingClients,
+			}
+
+			d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+			ctx := context.Background()
+			for _, client := range []string{"client-1", "client-2", "client-3"} {
+				if err := d.RegisterClient(ctx, client, []string{"service-1"}); err != nil {
+					t.Fatalf("failed to register the client: %s", err)
+				}
+			}
+
+			got, err := d.DistributeServices(test.ctx(), services)
+			if (err != nil) != test.wantErr {
+				t.Errorf("want error %t, got %v", test.wantErr, err)
+			}
+
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+
+			for _, client := range []string{"client-1", "client-2", "client-3"} {
+				_, failing := test.failingClients[client]
+				if test.want.Skipped != 0 || failing {
+					continue
+				}
+
+				s, err := sc.GetSnapshot(client)
+				if err != nil {
+					t.Errorf("failed to get the snapshot of the client %s: %s", client, err)
+					continue
+				}
+
+				if n := len(s.GetResources(resource.ListenerType)); n != 1 {
+					t.Errorf("want 1 listener for the client %s, got %d", client, n)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributeServicesToFailedClients(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		distribute func(ctx context.Context, d *ServiceDistributor) (*entity.DistributionResult, error)
+	}{
+		"should retry the failed clients": {
+			distribute: func(ctx context.Context, d *ServiceDistributor) (*entity.DistributionResult, error) {
+				return d.DistributeServicesToFailedClients(ctx, services)
+			},
+		},
+		"should retry the failed clients along with the changed services": {
+			distribute: func(ctx context.Context, d *ServiceDistributor) (*entity.DistributionResult, error) {
+				return d.DistributeChangedServices(ctx, services, &entity.ServiceDiff{})
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sc := &failingSnapshotCache{
+				SnapshotCache: NewSnapshotCache(logr.Discard()),
+				failingClients: map[string]struct{}{
+					"client-2": {},
+				},
+			}
+
+			d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+			ctx := context.Background()
+			for _, client := range []string{"client-1", "client-2"} {
+				if err := d.RegisterClient(ctx, client, []string{"service-1"}); err != nil {
+					t.Fatalf("failed to register the client: %s", err)
+				}
+			}
+
+			if _, err := d.DistributeServices(ctx, services); err == nil {
+				t.Fatal("want an error, but got nil")
+			}
+
+			sc.failingClients = nil
+
+			got, err := test.distribute(ctx, d)
+			if err != nil {
+				t.Fatalf("failed to distribute services: %s", err)
+			}
+
+			if diff := cmp.Diff(got, &entity.DistributionResult{Succeeded: 1}); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+
+			if _, err := sc.GetSnapshot("client-2"); err != nil {
+				t.Errorf("failed to get the snapshot of the client client-2: %s", err)
+			}
+
+			got, err = test.distribute(ctx, d)
+			if err != nil {
+				t.Fatalf("failed to distribute services: %s", err)
+			}
+
+			if diff := cmp.Diff(got, &entity.DistributionResult{}); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnregisterClient(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+	}
+
+	sc := NewSnapshotCache(logr.Discard())
+	d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+	ctx := context.Background()
+	for _, client := range []string{"client-1", "client-2"} {
+		if err := d.RegisterClient(ctx, client, []string{"service-1"}); err != nil {
+			t.Fatalf("failed to register the client: %s", err)
+		}
+	}
+
+	if _, err := d.DistributeServices(ctx, services); err != nil {
+		t.Fatalf("failed to distribute services: %s", err)
+	}
+
+	if err := d.UnregisterClient(ctx, "client-1"); err != nil {
+		t.Fatalf("failed to unregister the client: %s", err)
+	}
+
+	if _, err := sc.GetSnapshot("client-1"); err == nil {
+		t.Error("want the snapshot of client-1 to be cleared, got the snapshot")
+	}
+
+	got, err := d.DistributeServices(ctx, services)
+	if err != nil {
+		t.Fatalf("failed to distribute services: %s", err)
+	}
+
+	if diff := cmp.Diff(got, &entity.DistributionResult{Succeeded: 1}); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
+
+func TestDistributeServicesToClient_VisibleTo(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+		{
+			Name:         "service-2",
+			Version:      "1",
+			VisibleTo:    []string{"production"},
+			DefaultRoute: &entity.Route{Name: "service-2", Host: "service-2.a.run.app"},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		client *entity.Client
+		want   []string
+	}{
+		"should distribute the services visible to the group of the client": {
+			client: &entity.Client{ID: "client-1", Group: "production"},
+			want:   []string{"service-1", "service-2"},
+		},
+		"should not distribute the services invisible to the group of the client even if it requests them": {
+			client: &entity.Client{ID: "client-1", Group: "staging"},
+			want:   []string{"service-1"},
+		},
+		"should not distribute the services invisible to the client which belongs to no group": {
+			client: &entity.Client{ID: "client-1"},
+			want:   []string{"service-1"},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sc := NewSnapshotCache(logr.Discard())
+			d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+			ctx := context.Background()
+			if err := d.RegisterClientAttributes(ctx, test.client); err != nil {
+				t.Fatalf("failed to register the attributes of the client: %s", err)
+			}
+
+			if err := d.DistributeServicesToClient(ctx, services, test.client.ID, []string{"service-1", "service-2"}); err != nil {
+				t.Fatalf("failed to distribute services to the client: %s", err)
+			}
+
+			s, err := sc.GetSnapshot(test.client.ID)
+			if err != nil {
+				t.Fatalf("failed to get the snapshot of the client: %s", err)
+			}
+
+			var got []string
+			for name := range s.GetResources(resource.ListenerType) {
+				got = append(got, name)
+			}
+
+			if diff := cmp.Diff(got, test.want, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDistributeClustersToClient_EDS(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		client *entity.Client
+		want   cluster.Cluster_DiscoveryType
+	}{
+		"should distribute the EDS cluster to the proxyless gRPC client": {
+			client: &entity.Client{ID: "client-1"},
+			want:   cluster.Cluster_EDS,
+		},
+		"should distribute the LOGICAL_DNS cluster to Envoy since it requires IP addresses as the endpoints": {
+			client: &entity.Client{ID: "client-1", Envoy: true},
+			want:   cluster.Cluster_LOGICAL_DNS,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sc := NewSnapshotCache(logr.Discard())
+			d := NewServiceDistributor(sc, true, "", "default", 2, newTestMetrics(t))
+
+			ctx := context.Background()
+			if err := d.RegisterClientAttributes(ctx, test.client); err != nil {
+				t.Fatalf("failed to register the attributes of the client: %s", err)
+			}
+
+			if err := d.DistributeClustersToClient(ctx, services, test.client.ID, nil); err != nil {
+				t.Fatalf("failed to distribute clusters to the client: %s", err)
+			}
+
+			s, err := sc.GetSnapshot(test.client.ID)
+			if err != nil {
+				t.Fatalf("failed to get the snapshot of the client: %s", err)
+			}
+
+			clu, ok := s.GetResources(resource.ClusterType)["service-1.a.run.app"].(*cluster.Cluster)
+			if !ok {
+				t.Fatal("want the cluster of the service, got nothing")
+			}
+
+			if got := clu.GetType(); got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDistributeClustersToClient_TransportSocket(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+	}
+
+	for name, test := range map[string]struct {
+		client *entity.Client
+		want   bool
+	}{
+		"should not attach the transport socket for the proxyless gRPC client which has not opted in": {
+			client: &entity.Client{ID: "client-1"},
+			want:   false,
+		},
+		"should attach the transport socket for the proxyless gRPC client which has opted in": {
+			client: &entity.Client{ID: "client-1", ProxylessSecurity: true},
+			want:   true,
+		},
+		"should attach the transport socket for Envoy": {
+			client: &entity.Client{ID: "client-1", Envoy: true},
+			want:   true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sc := NewSnapshotCache(logr.Discard())
+			d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+			ctx := context.Background()
+			if err := d.RegisterClientAttributes(ctx, test.client); err != nil {
+				t.Fatalf("failed to register the attributes of the client: %s", err)
+			}
+
+			if err := d.DistributeClustersToClient(ctx, services, test.client.ID, nil); err != nil {
+				t.Fatalf("failed to distribute clusters to the client: %s", err)
+			}
+
+			s, err := sc.GetSnapshot(test.client.ID)
+			if err != nil {
+				t.Fatalf("failed to get the snapshot of the client: %s", err)
+			}
+
+			clu, ok := s.GetResources(resource.ClusterType)["service-1.a.run.app"].(*cluster.Cluster)
+			if !ok {
+				t.Fatal("want the cluster of the service, got nothing")
+			}
+
+			if got := clu.GetTransportSocket() != nil; got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewTransportSocket(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		upstreamCABundle string
+		proxyless        bool
+		want             func(vc *tls.CertificateValidationContext)
+	}{
+		"should verify the host by the system trust store if the CA bundle is not configured": {
+			want: func(vc *tls.CertificateValidationContext) {
+				vc.SystemRootCerts = &tls.CertificateValidationContext_SystemRootCerts{}
+			},
+		},
+		"should verify the host by the CA bundle": {
+			upstreamCABundle: "/etc/ssl/certs/ca-certificates.crt",
+			want: func(vc *tls.CertificateValidationContext) {
+				vc.TrustedCa = &core.DataSource{
+					Specifier: &core.DataSource_Filename{
+						Filename: "/etc/ssl/certs/ca-certificates.crt",
+					},
+				}
+			},
+		},
+		"should verify the host by the certificate provider instance for the proxyless gRPC client": {
+			upstreamCABundle: "/etc/ssl/certs/ca-certificates.crt",
+			proxyless:        true,
+			want: func(vc *tls.CertificateValidationContext) {
+				vc.MatchSubjectAltNames = []*matcher.StringMatcher{
+					{
+						MatchPattern: &matcher.StringMatcher_Exact{
+							Exact: "service-1.a.run.app",
+						},
+					},
+				}
+				vc.CaCertificateProviderInstance = &tls.CertificateProviderPluginInstance{
+					InstanceName: "default",
+				}
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			d := NewServiceDistributor(NewSnapshotCache(logr.Discard()), false, test.upstreamCABundle, "default", 2, newTestMetrics(t))
+
+			ts, err := d.newTransportSocket("service-1.a.run.app", test.proxyless)
+			if err != nil {
+				t.Fatalf("failed to create the transport socket: %s", err)
+			}
+
+			got := new(tls.UpstreamTlsContext)
+			if err := ts.GetTypedConfig().UnmarshalTo(got); err != nil {
+				t.Fatalf("failed to unmarshal the UpstreamTlsContext: %s", err)
+			}
+
+			vc := &tls.CertificateValidationContext{
+				MatchTypedSubjectAltNames: []*tls.SubjectAltNameMatcher{
+					{
+						SanType: tls.SubjectAltNameMatcher_DNS,
+						Matcher: &matcher.StringMatcher{
+							MatchPattern: &matcher.StringMatcher_Exact{
+								Exact: "service-1.a.run.app",
+							},
+						},
+					},
+				},
+			}
+			test.want(vc)
+
+			want := &tls.UpstreamTlsContext{
+				Sni: "service-1.a.run.app",
+				CommonTlsContext: &tls.CommonTlsContext{
+					AlpnProtocols: []string{"h2", "http/1.1"},
+					ValidationContextType: &tls.CommonTlsContext_ValidationContext{
+						ValidationContext: vc,
+					},
+				},
+			}
+
+			if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	services := []*entity.Service{
+		{
+			Name:         "service-1",
+			Version:      "1",
+			DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+		},
+		{
+			Name:         "service-2",
+			Version:      "1",
+			VisibleTo:    []string{"production"},
+			DefaultRoute: &entity.Route{Name: "service-2", Host: "service-2.a.run.app"},
+		},
+	}
+
+	ctx := context.Background()
+
+	sc := NewSnapshotCache(logr.Discard())
+	d := NewServiceDistributor(sc, false, "", "default", 2, newTestMetrics(t))
+
+	if err := d.RegisterClientAttributes(ctx, &entity.Client{ID: "client-1", Group: "production"}); err != nil {
+		t.Fatalf("failed to register the attributes of the client: %s", err)
+	}
+
+	if err := d.DistributeServicesToClient(ctx, services, "client-1", nil); err != nil {
+		t.Fatalf("failed to distribute services to the client: %s", err)
+	}
+
+	req := &cache.Request{
+		Node:    &core.Node{Id: "client-1"},
+		TypeUrl: resource.ListenerType,
+	}
+
+	res, err := d.Fetch(ctx, services, &entity.Client{ID: "client-1", Group: "staging"}, req)
+	if err != nil {
+		t.Fatalf("failed to fetch: %s", err)
+	}
+
+	dres, err := res.GetDiscoveryResponse()
+	if err != nil {
+		t.Fatalf("failed to get the discovery response: %s", err)
+	}
+
+	if len(dres.Resources) != 1 {
+		t.Errorf("want only the listener visible to the fetch client, got %d listeners", len(dres.Resources))
+	}
+
+	s, err := sc.GetSnapshot("client-1")
+	if err != nil {
+		t.Fatalf("failed to get the snapshot of the client: %s", err)
+	}
+
+	var got []string
+	for name := range s.GetResources(resource.ListenerType) {
+		got = append(got, name)
+	}
+
+	// NOTE: the snapshot of the stream with the same node ID must be kept intact by the fetch.
+	if diff := cmp.Diff(got, []string{"service-1", "service-2"}, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+
+	req = &cache.Request{
+		Node:    &core.Node{Id: "client-2"},
+		TypeUrl: resource.ListenerType,
+	}
+
+	if _, err := d.Fetch(ctx, services, &entity.Client{ID: "client-2"}, req); err != nil {
+		t.Fatalf("failed to fetch: %s", err)
+	}
+
+	if _, err := sc.GetSnapshot("client-2"); err == nil {
+		t.Error("want no snapshot of the fetch-only client, got one")
+	}
+}
+
+// newTestRoute returns the route which the distributor generates for the host with the default timeout and no policies.
+func newTestRoute(name string, host string, match *route.RouteMatch) *route.Route {
+	return &route.Route{
+		Name:  name,
+		Match: match,
+		Action: &route.Route_Route{
+			Route: &route.RouteAction{
+				HostRewriteSpecifier: &route.RouteAction_AutoHostRewrite{
+					AutoHostRewrite: wrapperspb.Bool(true),
+				},
+				ClusterSpecifier: &route.RouteAction_Cluster{
+					Cluster: host,
+				},
+				Timeout: durationpb.New(defaultRouteTimeout),
+				MaxStreamDuration: &route.RouteAction_MaxStreamDuration{
+					MaxStreamDuration: durationpb.New(defaultRouteTimeout),
+				},
+			},
+		},
+	}
+}
+
+func newTestPrefixMatch(prefix string) *route.RouteMatch {
+	return &route.RouteMatch{
+		PathSpecifier: &route.RouteMatch_Prefix{
+			Prefix: prefix,
+		},
+	}
+}
+
+func newTestHeaderMatch(hm *route.HeaderMatcher) *route.RouteMatch {
+	match := newTestPrefixMatch("/")
+	match.Headers = []*route.HeaderMatcher{hm}
+
+	return match
+}
+
+func newTestQueryParameterMatch(qm *route.QueryParameterMatcher) *route.RouteMatch {
+	match := newTestPrefixMatch("/")
+	match.QueryParameters = []*route.QueryParameterMatcher{qm}
+
+	return match
+}
+
+func newTestRouteConfiguration(name string, routes ...*route.Route) *route.RouteConfiguration {
+	return &route.RouteConfiguration{
+		Name: name,
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    name,
+				Domains: []string{name},
+				Routes:  routes,
+			},
+		},
+	}
+}
+
+func TestGenerateRouteConfiguration(t *testing.T) {
+	t.Parallel()
+
+	origin := &entity.Route{Name: "service-1", Host: "service-1.a.run.app"}
+
+	headerMatcher := func(value string) entity.Matcher {
+		return entity.Matcher{Source: entity.MatcherSourceHeader, Name: "x-route", Kind: entity.MatchKindExact, Value: value}
+	}
+
+	exactHeaderMatch := func(value string) *route.RouteMatch {
+		return newTestHeaderMatch(&route.HeaderMatcher{
+			Name:                 "x-route",
+			HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: value},
+		})
+	}
+
+	withWeightedClusters := func(r *route.Route, clusters ...*route.WeightedCluster_ClusterWeight) *route.Route {
+		r.GetRoute().ClusterSpecifier = &route.RouteAction_WeightedClusters{
+			WeightedClusters: &route.WeightedCluster{
+				Clusters: clusters,
+			},
+		}
+
+		return r
+	}
+
+	routesByName := func(routes ...*entity.Route) map[string]*entity.Route {
+		m := make(map[string]*entity.Route, len(routes))
+		for _, r := range routes {
+			m[r.Name] = r
+		}
+
+		return m
+	}
+
+	clusterWeight := func(host string, weight uint32) *route.WeightedCluster_ClusterWeight {
+		return &route.WeightedCluster_ClusterWeight{
+			Name:   host,
+			Weight: wrapperspb.UInt32(weight),
+		}
+	}
+
+	servedBy := &core.HeaderValueOption{
+		Header: &core.HeaderValue{
+			Key:   "x-cloud-run-service-router-served-by",
+			Value: "route-1",
+		},
+		AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+
+	for name, test := range map[string]struct {
+		service *entity.Service
+		want    func() *route.RouteConfiguration
+	}{
+		"should send all requests to the origin service if it has no routes": {
+			service: &entity.Service{Name: "service-1", DefaultRoute: origin},
+			want: func() *route.RouteConfiguration {
+				return newTestRouteConfiguration("service-1", newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")))
+			},
+		},
+		"should split the rest of the weights to the origin service": {
+			service: &entity.Service{
+				Name:         "service-1",
+				DefaultRoute: origin,
+				Routes: routesByName(
+					&entity.Route{Name: "route-2", Host: "route-2.a.run.app", Matcher: headerMatcher("route-2"), Weight: 20},
+					&entity.Route{Name: "route-1", Host: "route-1.a.run.app", Matcher: headerMatcher("route-1"), Weight: 30},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				return newTestRouteConfiguration(
+					"service-1",
+					newTestRoute("route-1", "route-1.a.run.app", exactHeaderMatch("route-1")),
+					newTestRoute("route-2", "route-2.a.run.app", exactHeaderMatch("route-2")),
+					withWeightedClusters(
+						newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")),
+						clusterWeight("service-1.a.run.app", 50),
+						clusterWeight("route-1.a.run.app", 30),
+						clusterWeight("route-2.a.run.app", 20),
+					),
+				)
+			},
+		},
+		"should apply the timeout and the retry policy of the origin service to the weighted clusters": {
+			service: &entity.Service{
+				Name: "service-1",
+				DefaultRoute: &entity.Route{
+					Name:        "service-1",
+					Host:        "service-1.a.run.app",
+					Timeout:     30 * time.Second,
+					RetryPolicy: &entity.RetryPolicy{RetryOn: []string{"5xx"}, NumRetries: 1},
+				},
+				Routes: routesByName(
+					&entity.Route{
+						Name:        "route-1",
+						Host:        "route-1.a.run.app",
+						Matcher:     headerMatcher("route-1"),
+						Weight:      30,
+						Timeout:     60 * time.Second,
+						RetryPolicy: &entity.RetryPolicy{RetryOn: []string{"unavailable"}, NumRetries: 3},
+					},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				withPolicies := func(r *route.Route, timeout time.Duration, retryOn string, numRetries uint32) *route.Route {
+					action := r.GetRoute()
+					action.Timeout = durationpb.New(timeout)
+					action.MaxStreamDuration.MaxStreamDuration = durationpb.New(timeout)
+					action.RetryPolicy = &route.RetryPolicy{
+						RetryOn:    retryOn,
+						NumRetries: wrapperspb.UInt32(numRetries),
+					}
+
+					return r
+				}
+
+				return newTestRouteConfiguration(
+					"service-1",
+					withPolicies(newTestRoute("route-1", "route-1.a.run.app", exactHeaderMatch("route-1")), 60*time.Second, "unavailable", 3),
+					withWeightedClusters(
+						withPolicies(newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")), 30*time.Second, "5xx", 1),
+						clusterWeight("service-1.a.run.app", 70),
+						clusterWeight("route-1.a.run.app", 30),
+					),
+				)
+			},
+		},
+		"should not send the traffic to the origin service if the total weight of the routes is 100": {
+			service: &entity.Service{
+				Name:         "service-1",
+				DefaultRoute: origin,
+				Routes: routesByName(
+					&entity.Route{Name: "route-1", Host: "route-1.a.run.app", Matcher: headerMatcher("route-1"), Weight: 60},
+					&entity.Route{Name: "route-2", Host: "route-2.a.run.app", Matcher: headerMatcher("route-2"), Weight: 40},
+					&entity.Route{Name: "route-3", Host: "route-3.a.run.app", Matcher: headerMatcher("route-3")},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				return newTestRouteConfiguration(
+					"service-1",
+					newTestRoute("route-1", "route-1.a.run.app", exactHeaderMatch("route-1")),
+					newTestRoute("route-2", "route-2.a.run.app", exactHeaderMatch("route-2")),
+					newTestRoute("route-3", "route-3.a.run.app", exactHeaderMatch("route-3")),
+					withWeightedClusters(
+						newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")),
+						clusterWeight("route-1.a.run.app", 60),
+						clusterWeight("route-2.a.run.app", 40),
+					),
+				)
+			},
+		},
+		"should put the gRPC method routes and then the longer path prefix routes after the header routes": {
+			service: &entity.Service{
+				Name:         "service-1",
+				DefaultRoute: origin,
+				Routes: routesByName(
+					&entity.Route{Name: "route-1", Host: "route-1.a.run.app", Matcher: headerMatcher("route-1"), PathPrefix: "/v2", GRPCMethods: []string{"/pkg.Foo/Bar", "/pkg.Foo/Baz"}},
+					&entity.Route{Name: "route-2", Host: "route-2.a.run.app", Matcher: headerMatcher("route-2"), PathPrefix: "/v2/users", GRPCMethods: []string{"/pkg.Foo/Aaa"}},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				path := func(p string) *route.RouteMatch {
+					return &route.RouteMatch{PathSpecifier: &route.RouteMatch_Path{Path: p}}
+				}
+
+				return newTestRouteConfiguration(
+					"service-1",
+					newTestRoute("route-1", "route-1.a.run.app", exactHeaderMatch("route-1")),
+					newTestRoute("route-2", "route-2.a.run.app", exactHeaderMatch("route-2")),
+					newTestRoute("route-2", "route-2.a.run.app", path("/pkg.Foo/Aaa")),
+					newTestRoute("route-1", "route-1.a.run.app", path("/pkg.Foo/Bar")),
+					newTestRoute("route-1", "route-1.a.run.app", path("/pkg.Foo/Baz")),
+					newTestRoute("route-2", "route-2.a.run.app", newTestPrefixMatch("/v2/users")),
+					newTestRoute("route-1", "route-1.a.run.app", newTestPrefixMatch("/v2")),
+					newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")),
+				)
+			},
+		},
+		"should generate the header and the query parameter matchers of each kind": {
+			service: &entity.Service{
+				Name:         "service-1",
+				DefaultRoute: origin,
+				Routes: routesByName(
+					&entity.Route{Name: "route-1", Host: "route-1.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceHeader, Name: "x-route", Kind: entity.MatchKindPrefix, Value: "pr-"}},
+					&entity.Route{Name: "route-2", Host: "route-2.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceHeader, Name: "x-route", Kind: entity.MatchKindSafeRegex, Value: "^pr-[0-9]+$"}},
+					&entity.Route{Name: "route-3", Host: "route-3.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceHeader, Name: "x-canary", Kind: entity.MatchKindPresent}},
+					&entity.Route{Name: "route-4", Host: "route-4.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceQueryParameter, Name: "route", Kind: entity.MatchKindExact, Value: "route-4"}},
+					&entity.Route{Name: "route-5", Host: "route-5.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceQueryParameter, Name: "route", Kind: entity.MatchKindPrefix, Value: "pr-"}},
+					&entity.Route{Name: "route-6", Host: "route-6.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceQueryParameter, Name: "route", Kind: entity.MatchKindSafeRegex, Value: "^pr-[0-9]+$"}},
+					&entity.Route{Name: "route-7", Host: "route-7.a.run.app", Matcher: entity.Matcher{Source: entity.MatcherSourceQueryParameter, Name: "canary", Kind: entity.MatchKindPresent}},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				stringMatch := func(m *matcher.StringMatcher) *route.QueryParameterMatcher_StringMatch {
+					return &route.QueryParameterMatcher_StringMatch{StringMatch: m}
+				}
+
+				return newTestRouteConfiguration(
+					"service-1",
+					newTestRoute("route-1", "route-1.a.run.app", newTestHeaderMatch(&route.HeaderMatcher{
+						Name:                 "x-route",
+						HeaderMatchSpecifier: &route.HeaderMatcher_PrefixMatch{PrefixMatch: "pr-"},
+					})),
+					newTestRoute("route-2", "route-2.a.run.app", newTestHeaderMatch(&route.HeaderMatcher{
+						Name:                 "x-route",
+						HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{SafeRegexMatch: &matcher.RegexMatcher{Regex: "^pr-[0-9]+$"}},
+					})),
+					newTestRoute("route-3", "route-3.a.run.app", newTestHeaderMatch(&route.HeaderMatcher{
+						Name:                 "x-canary",
+						HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: true},
+					})),
+					newTestRoute("route-4", "route-4.a.run.app", newTestQueryParameterMatch(&route.QueryParameterMatcher{
+						Name:                         "route",
+						QueryParameterMatchSpecifier: stringMatch(&matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: "route-4"}}),
+					})),
+					newTestRoute("route-5", "route-5.a.run.app", newTestQueryParameterMatch(&route.QueryParameterMatcher{
+						Name:                         "route",
+						QueryParameterMatchSpecifier: stringMatch(&matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "pr-"}}),
+					})),
+					newTestRoute("route-6", "route-6.a.run.app", newTestQueryParameterMatch(&route.QueryParameterMatcher{
+						Name:                         "route",
+						QueryParameterMatchSpecifier: stringMatch(&matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_SafeRegex{SafeRegex: &matcher.RegexMatcher{Regex: "^pr-[0-9]+$"}}}),
+					})),
+					newTestRoute("route-7", "route-7.a.run.app", newTestQueryParameterMatch(&route.QueryParameterMatcher{
+						Name:                         "canary",
+						QueryParameterMatchSpecifier: &route.QueryParameterMatcher_PresentMatch{PresentMatch: true},
+					})),
+					newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")),
+				)
+			},
+		},
+		"should generate the retry and the hedge policies": {
+			service: &entity.Service{
+				Name: "service-1",
+				DefaultRoute: &entity.Route{
+					Name:    "service-1",
+					Host:    "service-1.a.run.app",
+					Timeout: 30 * time.Second,
+					RetryPolicy: &entity.RetryPolicy{
+						RetryOn:              []string{"unavailable", "5xx"},
+						NumRetries:           3,
+						PerTryTimeout:        2 * time.Second,
+						BaseInterval:         100 * time.Millisecond,
+						MaxInterval:          time.Second,
+						RetriableStatusCodes: []uint32{409},
+					},
+					HedgePolicy: &entity.HedgePolicy{
+						InitialRequests:      2,
+						HedgeOnPerTryTimeout: true,
+					},
+				},
+			},
+			want: func() *route.RouteConfiguration {
+				r := newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/"))
+
+				action := r.GetRoute()
+				action.Timeout = durationpb.New(30 * time.Second)
+				action.MaxStreamDuration.MaxStreamDuration = durationpb.New(30 * time.Second)
+				action.RetryPolicy = &route.RetryPolicy{
+					RetryOn:       "unavailable,5xx",
+					NumRetries:    wrapperspb.UInt32(3),
+					PerTryTimeout: durationpb.New(2 * time.Second),
+					RetryBackOff: &route.RetryPolicy_RetryBackOff{
+						BaseInterval: durationpb.New(100 * time.Millisecond),
+						MaxInterval:  durationpb.New(time.Second),
+					},
+					RetriableStatusCodes: []uint32{409},
+				}
+				action.HedgePolicy = &route.HedgePolicy{
+					InitialRequests:      wrapperspb.UInt32(2),
+					HedgeOnPerTryTimeout: true,
+				}
+
+				return newTestRouteConfiguration("service-1", r)
+			},
+		},
+		"should mutate the headers by the routes and by the weighted clusters": {
+			service: &entity.Service{
+				Name: "service-1",
+				DefaultRoute: &entity.Route{
+					Name: "service-1",
+					Host: "service-1.a.run.app",
+					HeaderMutation: entity.HeaderMutation{
+						RequestHeadersToAdd:    []entity.Header{{Name: "x-env", Value: "production"}},
+						RequestHeadersToRemove: []string{"x-debug"},
+					},
+				},
+				Routes: routesByName(
+					&entity.Route{
+						Name:    "route-1",
+						Host:    "route-1.a.run.app",
+						Matcher: headerMatcher("route-1"),
+						Weight:  10,
+						HeaderMutation: entity.HeaderMutation{
+							ResponseHeadersToAdd:    []entity.Header{{Name: "x-cloud-run-service-router-served-by", Value: "route-1"}},
+							ResponseHeadersToRemove: []string{"server"},
+						},
+					},
+				),
+			},
+			want: func() *route.RouteConfiguration {
+				env := &core.HeaderValueOption{
+					Header: &core.HeaderValue{
+						Key:   "x-env",
+						Value: "production",
+					},
+					AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+				}
+
+				header := newTestRoute("route-1", "route-1.a.run.app", exactHeaderMatch("route-1"))
+				header.ResponseHeadersToAdd = []*core.HeaderValueOption{servedBy}
+				header.ResponseHeadersToRemove = []string{"server"}
+
+				originWeight := clusterWeight("service-1.a.run.app", 90)
+				originWeight.RequestHeadersToAdd = []*core.HeaderValueOption{env}
+				originWeight.RequestHeadersToRemove = []string{"x-debug"}
+
+				routeWeight := clusterWeight("route-1.a.run.app", 10)
+				routeWeight.ResponseHeadersToAdd = []*core.HeaderValueOption{servedBy}
+				routeWeight.ResponseHeadersToRemove = []string{"server"}
+
+				// NOTE: the default route itself does not mutate the headers since each weighted cluster does.
+				return newTestRouteConfiguration(
+					"service-1",
+					header,
+					withWeightedClusters(newTestRoute("service-1", "service-1.a.run.app", newTestPrefixMatch("/")), originWeight, routeWeight),
+				)
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := generateRouteConfiguration(test.service)
+
+			if diff := cmp.Diff(got, test.want(), protocmp.Transform()); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
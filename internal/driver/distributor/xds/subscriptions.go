@@ -0,0 +1,163 @@
+package xds
+
+import (
+	"sync"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+// subscriptions holds the resource names of a resource type requested by each client,
+// and the reverse index from the resource names to the clients so that only the clients affected by changes are looked up.
+type subscriptions struct {
+	sync.RWMutex
+
+	// requested is the resource names requested by each client. No name means that the client requests all resources.
+	requested map[string][]string
+
+	// clients is the reverse index from the resource name to the clients which request it.
+	clients map[string]map[string]struct{}
+
+	// wildcardClients are the clients which request all resources.
+	wildcardClients map[string]struct{}
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		requested:       make(map[string][]string),
+		clients:         make(map[string]map[string]struct{}),
+		wildcardClients: make(map[string]struct{}),
+	}
+}
+
+// register replaces the resource names requested by the client.
+func (s *subscriptions) register(client string, names []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.remove(client)
+
+	s.requested[client] = names
+
+	if len(names) == 0 {
+		s.wildcardClients[client] = struct{}{}
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := s.clients[name]; !ok {
+			s.clients[name] = make(map[string]struct{})
+		}
+		s.clients[name][client] = struct{}{}
+	}
+}
+
+// unregister removes the client and the resource names requested by it.
+func (s *subscriptions) unregister(client string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.remove(client)
+}
+
+// remove removes the client from the reverse index and the requested names. The caller must hold the lock.
+func (s *subscriptions) remove(client string) {
+	for _, name := range s.requested[client] {
+		delete(s.clients[name], client)
+		if len(s.clients[name]) == 0 {
+			delete(s.clients, name)
+		}
+	}
+
+	delete(s.wildcardClients, client)
+	delete(s.requested, client)
+}
+
+// all returns the resource names requested by all clients.
+func (s *subscriptions) all() map[string][]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string][]string, len(s.requested))
+	for client, names := range s.requested {
+		out[client] = names
+	}
+
+	return out
+}
+
+// affected returns the resource names requested by the clients which request any of the names or all resources.
+func (s *subscriptions) affected(names map[string]struct{}) map[string][]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string][]string)
+
+	for client := range s.wildcardClients {
+		out[client] = s.requested[client]
+	}
+
+	for name := range names {
+		for client := range s.clients[name] {
+			out[client] = s.requested[client]
+		}
+	}
+
+	return out
+}
+
+// only returns the resource names requested by the clients. The clients which request nothing of the type are omitted.
+func (s *subscriptions) only(clients map[string]struct{}) map[string][]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string][]string, len(clients))
+	for client := range clients {
+		if names, ok := s.requested[client]; ok {
+			out[client] = names
+		}
+	}
+
+	return out
+}
+
+// changedResourceNames are the names of the resources which are generated from the changed services.
+type changedResourceNames struct {
+	listeners map[string]struct{}
+	routes    map[string]struct{}
+	clusters  map[string]struct{}
+}
+
+// newChangedResourceNames returns the names of the resources generated from both the previous and the current services in the diff,
+// so that the clients which request the resources of the removed services or the removed routes are also affected.
+func newChangedResourceNames(diff *entity.ServiceDiff) *changedResourceNames {
+	names := &changedResourceNames{
+		listeners: make(map[string]struct{}),
+		routes:    make(map[string]struct{}),
+		clusters:  make(map[string]struct{}),
+	}
+
+	services := make([]*entity.Service, 0, len(diff.Added)+len(diff.Removed)+len(diff.Updated)*2)
+	services = append(services, diff.Added...)
+	services = append(services, diff.Removed...)
+	for _, u := range diff.Updated {
+		services = append(services, u.Previous, u.Current)
+	}
+
+	for _, service := range services {
+		names.listeners[service.Name] = struct{}{}
+		for _, alias := range service.Aliases {
+			names.listeners[alias] = struct{}{}
+		}
+
+		names.routes[service.Name] = struct{}{}
+
+		if service.DefaultRoute != nil {
+			names.clusters[service.DefaultRoute.Host] = struct{}{}
+		}
+		for _, r := range service.Routes {
+			names.clusters[r.Host] = struct{}{}
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,106 @@
+package xds
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+func TestSubscriptionsAffected(t *testing.T) {
+	t.Parallel()
+
+	s := newSubscriptions()
+	s.register("client-1", []string{"service-1", "service-2"})
+	s.register("client-2", []string{"service-2"})
+	s.register("client-3", nil)
+	s.register("client-4", []string{"service-3"})
+	// NOTE: the names of client-4 are replaced, so client-4 is no longer subscribing service-3.
+	s.register("client-4", []string{"service-4"})
+
+	for name, test := range map[string]struct {
+		names map[string]struct{}
+		want  map[string][]string
+	}{
+		"should return the clients which request the names and the wildcard clients": {
+			names: map[string]struct{}{
+				"service-2": {},
+			},
+			want: map[string][]string{
+				"client-1": {"service-1", "service-2"},
+				"client-2": {"service-2"},
+				"client-3": nil,
+			},
+		},
+		"should return only the wildcard clients if no client requests the names": {
+			names: map[string]struct{}{
+				"service-3": {},
+			},
+			want: map[string][]string{
+				"client-3": nil,
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := s.affected(test.names)
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewChangedResourceNames(t *testing.T) {
+	t.Parallel()
+
+	diff := &entity.ServiceDiff{
+		Added: []*entity.Service{
+			{
+				Name:         "service-1",
+				Aliases:      []string{"service-1.internal"},
+				DefaultRoute: &entity.Route{Name: "service-1", Host: "service-1.a.run.app"},
+			},
+		},
+		Updated: []*entity.ServiceUpdate{
+			{
+				Previous: &entity.Service{
+					Name:         "service-2",
+					DefaultRoute: &entity.Route{Name: "service-2", Host: "service-2.a.run.app"},
+					Routes: map[string]*entity.Route{
+						"service-2-canary": {Name: "service-2-canary", Host: "service-2-canary.a.run.app"},
+					},
+				},
+				Current: &entity.Service{
+					Name:         "service-2",
+					DefaultRoute: &entity.Route{Name: "service-2", Host: "service-2.a.run.app"},
+				},
+			},
+		},
+	}
+
+	want := &changedResourceNames{
+		listeners: map[string]struct{}{
+			"service-1":          {},
+			"service-1.internal": {},
+			"service-2":          {},
+		},
+		routes: map[string]struct{}{
+			"service-1": {},
+			"service-2": {},
+		},
+		clusters: map[string]struct{}{
+			"service-1.a.run.app":        {},
+			"service-2.a.run.app":        {},
+			"service-2-canary.a.run.app": {},
+		},
+	}
+
+	got := newChangedResourceNames(diff)
+	if diff := cmp.Diff(got, want, cmp.AllowUnexported(changedResourceNames{})); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
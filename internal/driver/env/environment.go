@@ -2,5 +2,13 @@ package env
 
 type Environments struct {
 	Port                 int    `envconfig:"PORT" required:"true"`
+	XDSHTTPPort          int    `envconfig:"XDS_HTTP_PORT"`
+	EventHTTPPort        int    `envconfig:"EVENT_HTTP_PORT"`
+	AdminHTTPPort        int    `envconfig:"ADMIN_HTTP_PORT"`
+	MetricsHTTPPort      int    `envconfig:"METRICS_HTTP_PORT"`
 	CloudRunEmulatorHost string `envconfig:"CLOUD_RUN_EMULATOR_HOST"`
+
+	// Spans are exported via OTLP only if either of the endpoints is set. The other settings of the exporter are read from the standard environment variables.
+	OTLPEndpoint       string `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTLPTracesEndpoint string `envconfig:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
 }
@@ -5,20 +5,33 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/kauche/gopubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/event"
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
 )
 
 var _ event.ServiceEventBroker = (*ServiceEventBroker)(nil)
 
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/driver/event/broker/gopubsub")
+
 type ServiceEventBroker struct {
-	topic  *gopubsub.Topic[struct{}]
+	topic  *gopubsub.Topic[*servicesRefreshedMessage]
 	logger logr.Logger
 }
 
+// servicesRefreshedMessage carries the span context of the publisher along with the event,
+// so that the span of the subscriber can be linked to it.
+type servicesRefreshedMessage struct {
+	event       *event.ServicesRefreshedEvent
+	spanContext trace.SpanContext
+}
+
 func NewServiceEventBroker(logger logr.Logger) *ServiceEventBroker {
 	return &ServiceEventBroker{
-		topic:  gopubsub.NewTopic[struct{}](),
+		topic:  gopubsub.NewTopic[*servicesRefreshedMessage](),
 		logger: logger,
 	}
 }
@@ -29,15 +42,36 @@ func (s *ServiceEventBroker) Start(ctx context.Context) error {
 	return nil
 }
 
-func (s *ServiceEventBroker) PublishServicesRefreshedEvent(ctx context.Context) error {
-	s.topic.Publish(struct{}{})
+func (s *ServiceEventBroker) PublishServicesRefreshedEvent(ctx context.Context, ev *event.ServicesRefreshedEvent) error {
+	_, span := tracer.Start(ctx, "ServiceEventBroker.PublishServicesRefreshedEvent", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	s.topic.Publish(&servicesRefreshedMessage{
+		event:       ev,
+		spanContext: span.SpanContext(),
+	})
 
 	return nil
 }
 
-func (s *ServiceEventBroker) SubscribeServicesRefreshedEvent(ctx context.Context, subscriber func() error) error {
-	s.topic.Subscribe(func(struct{}) {
-		if err := subscriber(); err != nil {
+func (s *ServiceEventBroker) SubscribeServicesRefreshedEvent(ctx context.Context, subscriber func(context.Context, *event.ServicesRefreshedEvent) error) error {
+	s.topic.Subscribe(func(msg *servicesRefreshedMessage) {
+		// NOTE: the span is linked to the span of the publisher instead of being its child, since the event is handled asynchronously.
+		ctx, span := tracer.Start(
+			context.Background(),
+			"ServiceEventBroker.HandleServicesRefreshedEvent",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(trace.Link{SpanContext: msg.spanContext}),
+			trace.WithAttributes(
+				attribute.Int("services.added", len(msg.event.Diff.Added)),
+				attribute.Int("services.removed", len(msg.event.Diff.Removed)),
+				attribute.Int("services.updated", len(msg.event.Diff.Updated)),
+			),
+		)
+		defer span.End()
+
+		if err := subscriber(ctx, msg.event); err != nil {
+			tracing.RecordError(span, err)
 			s.logger.Error(err, "failed to handle event by the subscriber")
 		}
 	})
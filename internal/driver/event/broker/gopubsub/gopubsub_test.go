@@ -0,0 +1,125 @@
+package gopubsub
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/event"
+)
+
+var (
+	exporter = tracetest.NewInMemoryExporter()
+	tp       = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+)
+
+func TestMain(m *testing.M) {
+	// NOTE: the global tracer provider is set only once since the tracer of the package keeps delegating to the first one.
+	otel.SetTracerProvider(tp)
+
+	os.Exit(m.Run())
+}
+
+// NOTE: this test must not be run in parallel since it inspects all spans recorded by the global tracer provider.
+func TestServiceEventBroker_Tracing(t *testing.T) {
+	exporter.Reset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	terminated := make(chan struct{})
+
+	b := NewServiceEventBroker(logr.Discard())
+
+	go func() {
+		defer close(terminated)
+
+		// NOTE: Start blocks until the context is canceled.
+		if err := b.Start(ctx); err != nil {
+			t.Errorf("failed to start the broker: %s", err)
+		}
+	}()
+
+	defer func() {
+		cancel()
+		<-terminated
+	}()
+
+	handled := make(chan trace.SpanContext, 1)
+
+	err := b.SubscribeServicesRefreshedEvent(ctx, func(ctx context.Context, ev *event.ServicesRefreshedEvent) error {
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe the event: %s", err)
+	}
+
+	pctx, parent := tp.Tracer("test").Start(ctx, "parent")
+
+	ev := &event.ServicesRefreshedEvent{
+		Diff:        &entity.ServiceDiff{Added: []*entity.Service{{Name: "service-1"}}},
+		RefreshedAt: time.Now(),
+	}
+
+	if err := b.PublishServicesRefreshedEvent(pctx, ev); err != nil {
+		t.Fatalf("failed to publish the event: %s", err)
+	}
+
+	parent.End()
+
+	var subscriberSpanContext trace.SpanContext
+	select {
+	case subscriberSpanContext = <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the event to be handled, got nothing")
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+
+	// NOTE: the span of the subscriber is ended asynchronously after the subscriber returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(spans) < 3 && time.Now().Before(deadline) {
+		for _, s := range exporter.GetSpans() {
+			spans[s.Name] = s
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	publish, ok := spans["ServiceEventBroker.PublishServicesRefreshedEvent"]
+	if !ok {
+		t.Fatal("want the span of the publisher, got nothing")
+	}
+
+	if got, want := publish.Parent.SpanID(), parent.SpanContext().SpanID(); got != want {
+		t.Errorf("want the parent %s of the publisher span, got %s", want, got)
+	}
+
+	handle, ok := spans["ServiceEventBroker.HandleServicesRefreshedEvent"]
+	if !ok {
+		t.Fatal("want the span of the subscriber, got nothing")
+	}
+
+	if got, want := handle.SpanContext.SpanID(), subscriberSpanContext.SpanID(); got != want {
+		t.Errorf("want the subscriber to receive the context of the span %s, got %s", want, got)
+	}
+
+	if handle.Parent.IsValid() {
+		t.Errorf("want no parent of the subscriber span, got %s", handle.Parent.SpanID())
+	}
+
+	if len(handle.Links) != 1 {
+		t.Fatalf("want 1 link, got %d", len(handle.Links))
+	}
+
+	if got, want := handle.Links[0].SpanContext.SpanID(), publish.SpanContext.SpanID(); got != want {
+		t.Errorf("want the link to the publisher span %s, got %s", want, got)
+	}
+}
@@ -3,9 +3,12 @@ package subscriber
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/event"
 	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
 )
 
@@ -21,14 +24,46 @@ func NewServiceEventSubscriber(uc *usecase.ServiceUseCase, logger logr.Logger) *
 	}
 }
 
-func (s *ServiceEventSubscriber) ServicesRefreshedEventHandler() error {
-	s.logger.Info("refreshing services")
+func (s *ServiceEventSubscriber) ServicesRefreshedEventHandler(ctx context.Context, ev *event.ServicesRefreshedEvent) error {
+	s.logger.Info(
+		"refreshing services",
+		"refreshedAt", ev.RefreshedAt.Format(time.RFC3339),
+		"added", serviceVersions(ev.Diff.Added),
+		"removed", serviceVersions(ev.Diff.Removed),
+		"updated", updatedServiceVersions(ev.Diff.Updated),
+	)
 
-	ctx := context.Background()
+	result, err := s.uc.DistributeChangedServices(ctx, ev.Diff)
+	if result != nil {
+		s.logger.Info(
+			"distributed services",
+			"succeeded", result.Succeeded,
+			"failed", result.Failed,
+			"skipped", result.Skipped,
+		)
+	}
 
-	if err := s.uc.DistributeServices(ctx); err != nil {
-		return fmt.Errorf("failed to distribute services: %w", err)
+	if err != nil {
+		return fmt.Errorf("failed to distribute changed services: %w", err)
 	}
 
 	return nil
 }
+
+func serviceVersions(services []*entity.Service) []string {
+	versions := make([]string, len(services))
+	for i, s := range services {
+		versions[i] = fmt.Sprintf("%s@%s", s.Name, s.Version)
+	}
+
+	return versions
+}
+
+func updatedServiceVersions(updates []*entity.ServiceUpdate) []string {
+	versions := make([]string, len(updates))
+	for i, u := range updates {
+		versions[i] = fmt.Sprintf("%s@%s->%s", u.Current.Name, u.Previous.Version, u.Current.Version)
+	}
+
+	return versions
+}
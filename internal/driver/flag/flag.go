@@ -3,7 +3,24 @@ package flag
 import "time"
 
 type Flags struct {
-	Project    string
-	Location   string
-	SyncPeriod time.Duration
+	Projects     []string
+	Locations    []string
+	SyncPeriod   time.Duration
+	HeaderPrefix string
+	EDS          bool
+
+	// RefreshDebounce is the delay to coalesce change notifications of services into a single refresh.
+	RefreshDebounce time.Duration
+	// ServiceSelector is the Kubernetes-style label selector of services to route. Empty means that all services are routed.
+	ServiceSelector string
+	// DistributionConcurrency is the maximum number of clients to which services are distributed concurrently.
+	DistributionConcurrency int
+	// ClientCleanupGracePeriod is the period to wait for a client to reconnect before its state is cleaned up after all of its streams are closed.
+	ClientCleanupGracePeriod time.Duration
+
+	UpstreamCABundle             string
+	ProxylessCertificateProvider string
+
+	// Verbosity is the maximum verbosity of logs. Zero emits only the info and the error logs.
+	Verbosity int
 }
@@ -4,23 +4,56 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	internal_flag "github.com/kauche/cloud-run-service-router-xds/internal/driver/flag"
 )
 
+// stringsValue is the flag value which can be repeated, and each of which can also be a comma-separated list.
+// The duplicated values are ignored so that the same parent is never listed twice.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(s string) error {
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" || slices.Contains(*v, e) {
+			continue
+		}
+
+		*v = append(*v, e)
+	}
+
+	return nil
+}
+
 func GetFlags() (*internal_flag.Flags, error) {
-	project := flag.String("project", "", "Google Cloud Project ID")
-	location := flag.String("location", "", "Google Cloud Run Location")
+	var projects, locations stringsValue
+	flag.Var(&projects, "project", "Google Cloud Project ID. Can be repeated or comma-separated to discover services across multiple projects. If listing services of a project fails, only its previous services are kept. On name collisions, the first service in the order of the projects and the locations keeps its name, and the others are named as name.location, or as name.location.project if it is taken as well")
+	flag.Var(&locations, "location", "Google Cloud Run Location. Can be repeated or comma-separated to discover services across multiple locations. If listing services of a location fails, only its previous services are kept. On name collisions, the first service in the order of the projects and the locations keeps its name, and the others are named as name.location, or as name.location.project if it is taken as well")
 	period := flag.String("sync-period", "", "Period to sync Services from Google Cloud Run")
+	debounce := flag.String("refresh-debounce", "5s", "Delay to coalesce change notifications of Google Cloud Run Services into a single sync")
+	eds := flag.Bool("eds", false, "Distribute EDS clusters with ClusterLoadAssignments instead of LOGICAL_DNS clusters to proxyless gRPC clients. Envoy always receives LOGICAL_DNS clusters since the endpoints are hostnames")
+	upstreamCABundle := flag.String("upstream-ca-bundle", "", "Path to the CA bundle which Envoy uses to verify Cloud Run services. The system trust store of Envoy is used if empty")
+	proxylessCertificateProvider := flag.String("proxyless-certificate-provider", "default", "Name of the certificate provider instance in the bootstrap of proxyless gRPC clients to verify Cloud Run services")
+	serviceSelector := flag.String("service-selector", "", "Kubernetes-style label selector (e.g. `team=payments,routable!=false`) of Cloud Run services to route")
+	cleanupGracePeriod := flag.String("client-cleanup-grace-period", "1m", "Period to wait for a client to reconnect before its state and snapshot are cleaned up after all of its streams are closed")
+	distributionConcurrency := flag.Int("distribution-concurrency", 16, "Maximum number of clients to which services are distributed concurrently")
+	verbosity := flag.Int("v", 0, "Verbosity of logs. 1 emits the debug logs such as the services excluded by the service selector")
+	headerPrefix := flag.String("header-prefix", "cloud-run-service-router-", "Prefix of the header name, followed by the origin service name, to route requests to route services")
 
 	flag.Parse()
 
-	if *project == "" {
+	if len(projects) == 0 {
 		return nil, errors.New("project is empty")
 	}
 
-	if *location == "" {
+	if len(locations) == 0 {
 		return nil, errors.New("location is empty")
 	}
 
@@ -28,14 +61,61 @@ func GetFlags() (*internal_flag.Flags, error) {
 		return nil, errors.New("sync-period is empty")
 	}
 
+	if *proxylessCertificateProvider == "" {
+		return nil, errors.New("proxyless-certificate-provider is empty")
+	}
+
+	if *distributionConcurrency <= 0 {
+		return nil, errors.New("distribution-concurrency must be positive")
+	}
+
+	if *verbosity < 0 {
+		return nil, errors.New("v must not be negative")
+	}
+
+	if *headerPrefix == "" {
+		return nil, errors.New("header-prefix is empty")
+	}
+
 	duration, err := time.ParseDuration(*period)
 	if err != nil {
 		return nil, fmt.Errorf("duration cannot be parsed: %w", err)
 	}
 
+	debounceDuration, err := time.ParseDuration(*debounce)
+	if err != nil {
+		return nil, fmt.Errorf("refresh-debounce cannot be parsed: %w", err)
+	}
+
+	if debounceDuration < 0 {
+		return nil, errors.New("refresh-debounce must not be negative")
+	}
+
+	cleanupGracePeriodDuration, err := time.ParseDuration(*cleanupGracePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("client-cleanup-grace-period cannot be parsed: %w", err)
+	}
+
+	if cleanupGracePeriodDuration < 0 {
+		return nil, errors.New("client-cleanup-grace-period must not be negative")
+	}
+
 	return &internal_flag.Flags{
-		Project:    *project,
-		Location:   *location,
-		SyncPeriod: duration,
+		Projects:     projects,
+		Locations:    locations,
+		SyncPeriod:   duration,
+		HeaderPrefix: *headerPrefix,
+		EDS:          *eds,
+
+		RefreshDebounce: debounceDuration,
+		ServiceSelector: *serviceSelector,
+
+		DistributionConcurrency:  *distributionConcurrency,
+		ClientCleanupGracePeriod: cleanupGracePeriodDuration,
+
+		UpstreamCABundle:             *upstreamCABundle,
+		ProxylessCertificateProvider: *proxylessCertificateProvider,
+
+		Verbosity: *verbosity,
 	}, nil
 }
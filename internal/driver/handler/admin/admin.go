@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/go-logr/logr"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/repository"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/httpserver"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/inventory"
+	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
+)
+
+// NewServer creates the HTTP server which serves the discovered services and the connected clients as JSON for operators:
+//
+//   - `GET /services` lists all services.
+//   - `GET /services/{name}` returns the service with the name.
+//   - `GET /clients` lists all connected clients.
+//   - `GET /clients/{id}` returns the connected client with the node ID, which must be escaped if it contains `/`.
+//   - `GET /clients/{id}/snapshot` returns the snapshot of the client in the snapshot cache.
+func NewServer(uc *usecase.ServiceUseCase, inv *inventory.Inventory, sc cache.SnapshotCache, port int, logger logr.Logger) *httpserver.Server {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /services", &servicesHandler{
+		uc:     uc,
+		logger: logger,
+	})
+
+	mux.Handle("GET /services/{name}", &serviceHandler{
+		uc:     uc,
+		logger: logger,
+	})
+
+	mux.Handle("GET /clients", &clientsHandler{
+		inventory: inv,
+		logger:    logger,
+	})
+
+	mux.Handle("GET /clients/{id}", &clientHandler{
+		inventory: inv,
+		logger:    logger,
+	})
+
+	mux.Handle("GET /clients/{id}/snapshot", &snapshotHandler{
+		snapshotCache: sc,
+		logger:        logger,
+	})
+
+	return httpserver.NewServer(mux, port)
+}
+
+type servicesHandler struct {
+	uc     *usecase.ServiceUseCase
+	logger logr.Logger
+}
+
+func (h *servicesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	services, err := h.uc.ListAllServices(ctx)
+	if err != nil {
+		h.logger.Error(err, "failed to list services")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	refreshedAt, err := h.uc.LastRefreshedAt(ctx)
+	if err != nil {
+		h.logger.Error(err, "failed to get the time when services were refreshed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := &servicesResponse{
+		RefreshedAt: newTimeResponse(refreshedAt),
+		Services:    make([]*serviceResponse, len(services)),
+	}
+
+	for i, s := range services {
+		res.Services[i] = newServiceResponse(s)
+	}
+
+	sort.SliceStable(res.Services, func(i, j int) bool {
+		return strings.Compare(res.Services[i].Name, res.Services[j].Name) < 0
+	})
+
+	writeJSON(w, res, h.logger)
+}
+
+type serviceHandler struct {
+	uc     *usecase.ServiceUseCase
+	logger logr.Logger
+}
+
+func (h *serviceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("name")
+
+	service, err := h.uc.GetService(ctx, name)
+	if errors.Is(err, repository.ErrServiceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error(err, "failed to get the service", "name", name)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	refreshedAt, err := h.uc.LastRefreshedAt(ctx)
+	if err != nil {
+		h.logger.Error(err, "failed to get the time when services were refreshed")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, &serviceDetailResponse{
+		RefreshedAt: newTimeResponse(refreshedAt),
+		Service:     newServiceResponse(service),
+	}, h.logger)
+}
+
+type clientsHandler struct {
+	inventory *inventory.Inventory
+	logger    logr.Logger
+}
+
+func (h *clientsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clients := h.inventory.Clients()
+
+	res := &clientsResponse{
+		Clients: make([]*clientResponse, len(clients)),
+	}
+
+	for i, c := range clients {
+		res.Clients[i] = newClientResponse(c)
+	}
+
+	writeJSON(w, res, h.logger)
+}
+
+type clientHandler struct {
+	inventory *inventory.Inventory
+	logger    logr.Logger
+}
+
+func (h *clientHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	client, ok := h.inventory.Client(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("the client `%s` is not connected", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, newClientResponse(client), h.logger)
+}
+
+type snapshotHandler struct {
+	snapshotCache cache.SnapshotCache
+	logger        logr.Logger
+}
+
+func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snapshot, err := h.snapshotCache.GetSnapshot(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("the snapshot of the client `%s` does not exist: %s", id, err), http.StatusNotFound)
+		return
+	}
+
+	res, err := newSnapshotResponse(snapshot)
+	if err != nil {
+		h.logger.Error(err, "failed to convert the snapshot", "id", id)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, res, h.logger)
+}
+
+func writeJSON(w http.ResponseWriter, v any, logger logr.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	// NOTE: the status code has already been sent when the encoding fails, so the error is only logged.
+	if err := enc.Encode(v); err != nil {
+		logger.Error(err, "failed to write the response")
+	}
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/inventory"
+)
+
+type clientsResponse struct {
+	Clients []*clientResponse `json:"clients"`
+}
+
+type clientResponse struct {
+	ID        string            `json:"id"`
+	Cluster   string            `json:"cluster,omitempty"`
+	UserAgent string            `json:"userAgent,omitempty"`
+	Locality  *localityResponse `json:"locality,omitempty"`
+	Metadata  map[string]any    `json:"metadata,omitempty"`
+	Streams   []*streamResponse `json:"streams"`
+}
+
+type localityResponse struct {
+	Region  string `json:"region,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	SubZone string `json:"subZone,omitempty"`
+}
+
+type streamResponse struct {
+	ID       int64     `json:"id"`
+	Delta    bool      `json:"delta"`
+	OpenedAt time.Time `json:"openedAt"`
+
+	// Resources are the states of the resources by the type URL.
+	Resources map[string]*resourceTypeResponse `json:"resources"`
+}
+
+type resourceTypeResponse struct {
+	// RequestedNames are empty if the client requests all resources of the type.
+	RequestedNames   []string `json:"requestedNames"`
+	LastSentVersion  string   `json:"lastSentVersion,omitempty"`
+	LastAckedVersion string   `json:"lastAckedVersion,omitempty"`
+	LastNackError    string   `json:"lastNackError,omitempty"`
+}
+
+// snapshotResponse is the resources of the snapshot by the type URL.
+type snapshotResponse map[string]*snapshotResourcesResponse
+
+type snapshotResourcesResponse struct {
+	Version string `json:"version"`
+
+	// Resources are the resources in the JSON mapping of protobuf by their names.
+	Resources map[string]json.RawMessage `json:"resources"`
+}
+
+func newClientResponse(c *inventory.Client) *clientResponse {
+	res := &clientResponse{
+		ID:        c.ID,
+		Cluster:   c.Node.GetCluster(),
+		UserAgent: newUserAgentResponse(c.Node),
+		Metadata:  c.Node.GetMetadata().AsMap(),
+		Streams:   make([]*streamResponse, len(c.Streams)),
+	}
+
+	if l := c.Node.GetLocality(); l != nil {
+		res.Locality = &localityResponse{
+			Region:  l.GetRegion(),
+			Zone:    l.GetZone(),
+			SubZone: l.GetSubZone(),
+		}
+	}
+
+	for i, s := range c.Streams {
+		sr := &streamResponse{
+			ID:        s.ID,
+			Delta:     s.Delta,
+			OpenedAt:  s.OpenedAt,
+			Resources: make(map[string]*resourceTypeResponse, len(s.ResourceTypes)),
+		}
+
+		for typeURL, rt := range s.ResourceTypes {
+			sr.Resources[typeURL] = &resourceTypeResponse{
+				RequestedNames:   rt.RequestedNames,
+				LastSentVersion:  rt.LastSentVersion,
+				LastAckedVersion: rt.LastAckedVersion,
+				LastNackError:    rt.LastNackError,
+			}
+		}
+
+		res.Streams[i] = sr
+	}
+
+	return res
+}
+
+// newUserAgentResponse returns the user agent like `envoy/1.36.0`. It returns only the name if the node has no version.
+func newUserAgentResponse(node *core.Node) string {
+	name := node.GetUserAgentName()
+	if name == "" {
+		return ""
+	}
+
+	if v := node.GetUserAgentVersion(); v != "" {
+		return name + "/" + v
+	}
+
+	if v := node.GetUserAgentBuildVersion().GetVersion(); v != nil {
+		return fmt.Sprintf("%s/%d.%d.%d", name, v.GetMajorNumber(), v.GetMinorNumber(), v.GetPatch())
+	}
+
+	return name
+}
+
+func newSnapshotResponse(snapshot cache.ResourceSnapshot) (snapshotResponse, error) {
+	res := make(snapshotResponse)
+
+	for _, typeURL := range []string{resource.ListenerType, resource.RouteType, resource.ClusterType, resource.EndpointType} {
+		rs := &snapshotResourcesResponse{
+			Version:   snapshot.GetVersion(typeURL),
+			Resources: make(map[string]json.RawMessage),
+		}
+
+		for name, r := range snapshot.GetResources(typeURL) {
+			b, err := protojson.Marshal(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal the resource `%s` of the type `%s`: %w", name, typeURL, err)
+			}
+
+			rs.Resources[name] = b
+		}
+
+		res[typeURL] = rs
+	}
+
+	return res, nil
+}
@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+type servicesResponse struct {
+	// RefreshedAt is null if services have never been refreshed.
+	RefreshedAt *time.Time         `json:"refreshedAt"`
+	Services    []*serviceResponse `json:"services"`
+}
+
+type serviceDetailResponse struct {
+	RefreshedAt *time.Time       `json:"refreshedAt"`
+	Service     *serviceResponse `json:"service"`
+}
+
+type serviceResponse struct {
+	Name         string           `json:"name"`
+	Version      string           `json:"version"`
+	Aliases      []string         `json:"aliases,omitempty"`
+	VisibleTo    []string         `json:"visibleTo,omitempty"`
+	DefaultRoute *routeResponse   `json:"defaultRoute"`
+	Routes       []*routeResponse `json:"routes"`
+}
+
+type routeResponse struct {
+	Name           string                  `json:"name"`
+	Host           string                  `json:"host"`
+	Version        string                  `json:"version"`
+	Endpoints      []string                `json:"endpoints,omitempty"`
+	Matcher        *matcherResponse        `json:"matcher,omitempty"`
+	Timeout        string                  `json:"timeout,omitempty"`
+	Weight         uint32                  `json:"weight"`
+	PathPrefix     string                  `json:"pathPrefix,omitempty"`
+	GRPCMethods    []string                `json:"grpcMethods,omitempty"`
+	RetryPolicy    *retryPolicyResponse    `json:"retryPolicy,omitempty"`
+	HedgePolicy    *hedgePolicyResponse    `json:"hedgePolicy,omitempty"`
+	HeaderMutation *headerMutationResponse `json:"headerMutation,omitempty"`
+}
+
+type matcherResponse struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value,omitempty"`
+}
+
+type retryPolicyResponse struct {
+	RetryOn              []string `json:"retryOn"`
+	NumRetries           uint32   `json:"numRetries"`
+	PerTryTimeout        string   `json:"perTryTimeout,omitempty"`
+	BaseInterval         string   `json:"baseInterval,omitempty"`
+	MaxInterval          string   `json:"maxInterval,omitempty"`
+	RetriableStatusCodes []uint32 `json:"retriableStatusCodes,omitempty"`
+}
+
+type hedgePolicyResponse struct {
+	InitialRequests      uint32 `json:"initialRequests,omitempty"`
+	HedgeOnPerTryTimeout bool   `json:"hedgeOnPerTryTimeout"`
+}
+
+type headerMutationResponse struct {
+	RequestHeadersToAdd     []headerResponse `json:"requestHeadersToAdd,omitempty"`
+	RequestHeadersToRemove  []string         `json:"requestHeadersToRemove,omitempty"`
+	ResponseHeadersToAdd    []headerResponse `json:"responseHeadersToAdd,omitempty"`
+	ResponseHeadersToRemove []string         `json:"responseHeadersToRemove,omitempty"`
+}
+
+type headerResponse struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func newTimeResponse(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func newServiceResponse(s *entity.Service) *serviceResponse {
+	res := &serviceResponse{
+		Name:         s.Name,
+		Version:      s.Version,
+		Aliases:      s.Aliases,
+		VisibleTo:    s.VisibleTo,
+		DefaultRoute: newRouteResponse(s.DefaultRoute),
+		Routes:       make([]*routeResponse, 0, len(s.Routes)),
+	}
+
+	for _, r := range s.Routes {
+		res.Routes = append(res.Routes, newRouteResponse(r))
+	}
+
+	sort.SliceStable(res.Routes, func(i, j int) bool {
+		return strings.Compare(res.Routes[i].Name, res.Routes[j].Name) < 0
+	})
+
+	return res
+}
+
+func newRouteResponse(r *entity.Route) *routeResponse {
+	res := &routeResponse{
+		Name:           r.Name,
+		Host:           r.Host,
+		Version:        r.Version,
+		Endpoints:      r.Endpoints,
+		Timeout:        newDurationResponse(r.Timeout),
+		Weight:         r.Weight,
+		PathPrefix:     r.PathPrefix,
+		GRPCMethods:    r.GRPCMethods,
+		HeaderMutation: newHeaderMutationResponse(r.HeaderMutation),
+	}
+
+	// NOTE: the default route has no matcher since it receives the requests which do not match any other route.
+	if r.Matcher.Name != "" {
+		res.Matcher = &matcherResponse{
+			Source: matcherSourceNames[r.Matcher.Source],
+			Name:   r.Matcher.Name,
+			Kind:   matchKindNames[r.Matcher.Kind],
+			Value:  r.Matcher.Value,
+		}
+	}
+
+	if p := r.RetryPolicy; p != nil {
+		res.RetryPolicy = &retryPolicyResponse{
+			RetryOn:              p.RetryOn,
+			NumRetries:           p.NumRetries,
+			PerTryTimeout:        newDurationResponse(p.PerTryTimeout),
+			BaseInterval:         newDurationResponse(p.BaseInterval),
+			MaxInterval:          newDurationResponse(p.MaxInterval),
+			RetriableStatusCodes: p.RetriableStatusCodes,
+		}
+	}
+
+	if p := r.HedgePolicy; p != nil {
+		res.HedgePolicy = &hedgePolicyResponse{
+			InitialRequests:      p.InitialRequests,
+			HedgeOnPerTryTimeout: p.HedgeOnPerTryTimeout,
+		}
+	}
+
+	return res
+}
+
+var matcherSourceNames = map[entity.MatcherSource]string{
+	entity.MatcherSourceHeader:         "header",
+	entity.MatcherSourceQueryParameter: "queryParameter",
+}
+
+var matchKindNames = map[entity.MatchKind]string{
+	entity.MatchKindExact:     "exact",
+	entity.MatchKindPrefix:    "prefix",
+	entity.MatchKindSafeRegex: "safeRegex",
+	entity.MatchKindPresent:   "present",
+}
+
+// newDurationResponse returns the duration like `1.5s`, or the empty string if it is zero so that the field is omitted.
+func newDurationResponse(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+func newHeaderMutationResponse(m entity.HeaderMutation) *headerMutationResponse {
+	if len(m.RequestHeadersToAdd) == 0 && len(m.RequestHeadersToRemove) == 0 && len(m.ResponseHeadersToAdd) == 0 && len(m.ResponseHeadersToRemove) == 0 {
+		return nil
+	}
+
+	return &headerMutationResponse{
+		RequestHeadersToAdd:     newHeaderResponses(m.RequestHeadersToAdd),
+		RequestHeadersToRemove:  m.RequestHeadersToRemove,
+		ResponseHeadersToAdd:    newHeaderResponses(m.ResponseHeadersToAdd),
+		ResponseHeadersToRemove: m.ResponseHeadersToRemove,
+	}
+}
+
+func newHeaderResponses(headers []entity.Header) []headerResponse {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	res := make([]headerResponse, len(headers))
+	for i, h := range headers {
+		res[i] = headerResponse{Name: h.Name, Value: h.Value}
+	}
+
+	return res
+}
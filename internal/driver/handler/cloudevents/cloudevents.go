@@ -0,0 +1,217 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/httpserver"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/worker/debouncer"
+)
+
+const (
+	// auditLogWrittenEventType is the type of the events which Eventarc delivers for Cloud Audit Logs.
+	auditLogWrittenEventType = "google.cloud.audit.log.v1.written"
+
+	// messagePublishedEventType is the type of the events which Eventarc delivers for Pub/Sub messages,
+	// e.g. Cloud Audit Logs routed to a Pub/Sub topic by a log sink.
+	messagePublishedEventType = "google.cloud.pubsub.topic.v1.messagePublished"
+
+	structuredContentType = "application/cloudevents+json"
+
+	// maxEventBytes is the maximum size of the body of an event, which is large enough for an audit log entry.
+	maxEventBytes = 1 << 20
+)
+
+// serviceChangeMethods are the Cloud Run Admin API methods which create, update or delete services.
+var serviceChangeMethods = map[string]struct{}{
+	"google.cloud.run.v1.Services.CreateService":  {},
+	"google.cloud.run.v1.Services.ReplaceService": {},
+	"google.cloud.run.v1.Services.DeleteService":  {},
+	"google.cloud.run.v2.Services.CreateService":  {},
+	"google.cloud.run.v2.Services.UpdateService":  {},
+	"google.cloud.run.v2.Services.DeleteService":  {},
+}
+
+// NewServer creates the HTTP server which receives CloudEvents of changes of Cloud Run services
+// in both of the binary and the structured content modes, or the Pub/Sub push messages, and triggers the refresh of services.
+func NewServer(debouncer *debouncer.ServiceRefreshDebouncer, port int, logger logr.Logger) *httpserver.Server {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", &eventHandler{
+		debouncer: debouncer,
+		logger:    logger,
+	})
+
+	return httpserver.NewServer(mux, port)
+}
+
+// event is the subset of a CloudEvent which is needed to decide whether services should be refreshed.
+type event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	Subject    string          `json:"subject"`
+	MethodName string          `json:"methodname"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type eventHandler struct {
+	debouncer *debouncer.ServiceRefreshDebouncer
+	logger    logr.Logger
+}
+
+func (h *eventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEventBytes)
+
+	ev, err := decodeEvent(r)
+	if err != nil {
+		h.logger.Error(err, "failed to decode the event")
+
+		if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changed, err := isServiceChange(ev)
+	if err != nil {
+		h.logger.Error(err, "failed to inspect the event", "id", ev.ID, "type", ev.Type)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// NOTE: events which are not related to services are acknowledged as well so that they are not redelivered.
+	if !changed {
+		h.logger.V(1).Info("ignored the event", "id", ev.ID, "type", ev.Type, "subject", ev.Subject)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.logger.Info("received the service change event", "id", ev.ID, "type", ev.Type, "subject", ev.Subject)
+
+	h.debouncer.Trigger()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// decodeEvent decodes the CloudEvent in the structured content mode if the content type is `application/cloudevents+json`,
+// in the binary content mode if the request has the `ce-` headers, and otherwise as the push message of a Pub/Sub subscription,
+// which is delivered as the event of the message with the envelope as its data.
+func decodeEvent(r *http.Request) (*event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the body: %w", err)
+	}
+
+	ev := new(event)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch {
+	case mediaType == structuredContentType:
+		if err := json.Unmarshal(body, ev); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the structured event: %w", err)
+		}
+	case r.Header.Get("ce-id") != "" || r.Header.Get("ce-type") != "" || r.Header.Get("ce-source") != "":
+		ev.ID = r.Header.Get("ce-id")
+		ev.Type = r.Header.Get("ce-type")
+		ev.Source = r.Header.Get("ce-source")
+		ev.Subject = r.Header.Get("ce-subject")
+		ev.MethodName = r.Header.Get("ce-methodname")
+		ev.Data = body
+	default:
+		ev, err = decodePushMessage(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ev.ID == "" || ev.Type == "" || ev.Source == "" {
+		return nil, errors.New("the event must have the attributes `id`, `type` and `source`")
+	}
+
+	return ev, nil
+}
+
+// decodePushMessage decodes the envelope of the Pub/Sub push message as the event of the message published to the subscription.
+func decodePushMessage(body []byte) (*event, error) {
+	var envelope struct {
+		Message struct {
+			MessageID string `json:"messageId"`
+		} `json:"message"`
+		Subscription string `json:"subscription"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the Pub/Sub push message: %w", err)
+	}
+
+	return &event{
+		ID:     envelope.Message.MessageID,
+		Type:   messagePublishedEventType,
+		Source: envelope.Subscription,
+		Data:   body,
+	}, nil
+}
+
+// isServiceChange returns true if the event notifies that a Cloud Run service has been created, updated or deleted.
+func isServiceChange(ev *event) (bool, error) {
+	switch ev.Type {
+	case auditLogWrittenEventType:
+		_, ok := serviceChangeMethods[ev.MethodName]
+		return ok, nil
+	case messagePublishedEventType:
+		methodName, err := methodNameFromMessage(ev.Data)
+		if err != nil {
+			return false, err
+		}
+
+		_, ok := serviceChangeMethods[methodName]
+		return ok, nil
+	}
+
+	return false, nil
+}
+
+// methodNameFromMessage returns the method name of the audit log entry in the Pub/Sub message.
+// It returns the empty string if the message is not an audit log entry.
+func methodNameFromMessage(data []byte) (string, error) {
+	var msg struct {
+		Message struct {
+			// NOTE: the data is base64-encoded in JSON, and decoded by unmarshaling it into []byte.
+			Data []byte `json:"data"`
+		} `json:"message"`
+	}
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", fmt.Errorf("failed to unmarshal the Pub/Sub message: %w", err)
+	}
+
+	var entry struct {
+		ProtoPayload struct {
+			MethodName string `json:"methodName"`
+		} `json:"protoPayload"`
+	}
+
+	if err := json.Unmarshal(msg.Message.Data, &entry); err != nil {
+		// NOTE: messages which are not JSON are not audit log entries.
+		return "", nil
+	}
+
+	return strings.TrimSpace(entry.ProtoPayload.MethodName), nil
+}
@@ -0,0 +1,133 @@
+package cloudevents
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestIsServiceChange(t *testing.T) {
+	t.Parallel()
+
+	auditLog := base64.StdEncoding.EncodeToString([]byte(`{"protoPayload":{"methodName":"google.cloud.run.v2.Services.UpdateService"}}`))
+
+	for name, test := range map[string]struct {
+		contentType string
+		headers     map[string]string
+		body        string
+		want        bool
+	}{
+		"should return true for the audit log event of updating a service in the binary content mode": {
+			contentType: "application/json",
+			headers: map[string]string{
+				"ce-id":          "1",
+				"ce-type":        "google.cloud.audit.log.v1.written",
+				"ce-source":      "//cloudaudit.googleapis.com/projects/test-project/logs/activity",
+				"ce-methodname":  "google.cloud.run.v1.Services.ReplaceService",
+				"ce-specversion": "1.0",
+			},
+			body: `{}`,
+			want: true,
+		},
+		"should return true for the audit log event of deleting a service in the structured content mode": {
+			contentType: "application/cloudevents+json; charset=utf-8",
+			body:        `{"specversion":"1.0","id":"2","type":"google.cloud.audit.log.v1.written","source":"//cloudaudit.googleapis.com/projects/test-project/logs/activity","methodname":"google.cloud.run.v2.Services.DeleteService","data":{}}`,
+			want:        true,
+		},
+		"should return true for the Pub/Sub message which has the audit log entry of updating a service": {
+			contentType: "application/json",
+			headers: map[string]string{
+				"ce-id":     "3",
+				"ce-type":   "google.cloud.pubsub.topic.v1.messagePublished",
+				"ce-source": "//pubsub.googleapis.com/projects/test-project/topics/cloud-run",
+			},
+			body: `{"message":{"data":"` + auditLog + `"},"subscription":"projects/test-project/subscriptions/cloud-run"}`,
+			want: true,
+		},
+		"should return true for the Pub/Sub push message without the ce- headers": {
+			contentType: "application/json",
+			body:        `{"message":{"data":"` + auditLog + `","messageId":"6"},"subscription":"projects/test-project/subscriptions/cloud-run"}`,
+			want:        true,
+		},
+		"should return false for the audit log event of other methods": {
+			contentType: "application/json",
+			headers: map[string]string{
+				"ce-id":         "4",
+				"ce-type":       "google.cloud.audit.log.v1.written",
+				"ce-source":     "//cloudaudit.googleapis.com/projects/test-project/logs/activity",
+				"ce-methodname": "google.cloud.run.v2.Jobs.RunJob",
+			},
+			body: `{}`,
+			want: false,
+		},
+		"should return false for the Pub/Sub message which is not an audit log entry": {
+			contentType: "application/json",
+			headers: map[string]string{
+				"ce-id":     "5",
+				"ce-type":   "google.cloud.pubsub.topic.v1.messagePublished",
+				"ce-source": "//pubsub.googleapis.com/projects/test-project/topics/cloud-run",
+			},
+			body: `{"message":{"data":"` + base64.StdEncoding.EncodeToString([]byte("hello")) + `"}}`,
+			want: false,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			ev, err := decodeEvent(req)
+			if err != nil {
+				t.Errorf("failed to decode the event: %s", err)
+				return
+			}
+
+			got, err := isServiceChange(ev)
+			if err != nil {
+				t.Errorf("failed to inspect the event: %s", err)
+				return
+			}
+
+			if got != test.want {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeEventWithoutRequiredAttributes(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-type", "google.cloud.audit.log.v1.written")
+
+	if _, err := decodeEvent(req); err == nil {
+		t.Error("want an error, but got nil")
+	}
+}
+
+func TestServeHTTPWithTooLargeBody(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"message":{"data":"`+strings.Repeat("a", maxEventBytes)+`"}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+
+	h := &eventHandler{logger: logr.Discard()}
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("want %v, got %v", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
@@ -4,32 +4,96 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	stream "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
 	server "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/go-logr/logr"
 
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/inventory"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
 	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
 )
 
 var _ server.Callbacks = (*callbacks)(nil)
 
+// proxylessSecurityMetadataKey is the key of the node metadata with which proxyless gRPC clients opt in to receive the xDS security settings.
+const proxylessSecurityMetadataKey = "kauche.com/cloud-run-service-router-proxyless-security"
+
+// envoyUserAgentName is the user agent name with which Envoy identifies itself in its node.
+const envoyUserAgentName = "envoy"
+
+// clientGroupMetadataKey is the key of the node metadata which specifies the group of the client. The cluster of the node is used if it is not specified.
+const clientGroupMetadataKey = "kauche.com/cloud-run-service-router-client-group"
+
 type callbacks struct {
 	uc            usecase.ServiceUseCase
 	snapshotCache cache.SnapshotCache
 	logger        logr.Logger
+
+	streams   *streamTracker
+	inventory *inventory.Inventory
+	metrics   *telemetry.Metrics
+
+	deltaStreamsMu struct {
+		sync.Mutex
+		deltaStreams map[int64]*deltaStream
+	}
+}
+
+// deltaStream holds the state of a delta xDS stream since the node and the resource names are sent only on the changes.
+type deltaStream struct {
+	node          *core.Node
+	subscriptions map[string]*stream.Subscription
+}
+
+func newCallbacks(uc usecase.ServiceUseCase, sc cache.SnapshotCache, inv *inventory.Inventory, metrics *telemetry.Metrics, cleanupGracePeriod time.Duration, logger logr.Logger) *callbacks {
+	c := &callbacks{
+		uc:            uc,
+		snapshotCache: sc,
+		inventory:     inv,
+		metrics:       metrics,
+		logger:        logger,
+	}
+
+	c.streams = newStreamTracker(cleanupGracePeriod, c.cleanupClient)
+
+	c.deltaStreamsMu.deltaStreams = make(map[int64]*deltaStream)
+
+	return c
 }
 
 func (c *callbacks) OnStreamOpen(_ context.Context, streamID int64, _ string) error {
 	c.logger.Info("stream opened", "streamID", streamID)
+
+	c.inventory.OpenStream(streamID, false)
+
 	return nil
 }
 
 func (c *callbacks) OnStreamClosed(streamID int64, node *core.Node) {
 	c.logger.Info("stream closed", "streamID", streamID)
+
+	c.streams.untrack(streamID)
+	c.inventory.CloseStream(streamID)
+}
+
+// cleanupClient unregisters the node, whose streams have all been closed, from the distributor so that nothing is distributed to it any longer.
+func (c *callbacks) cleanupClient(node string) {
+	if err := c.uc.UnregisterClientFromDistributor(context.Background(), node); err != nil {
+		c.logger.Error(err, "failed to unregister the client from the distributor", "node", node)
+		return
+	}
+
+	c.logger.Info("cleaned up the client", "node", node)
 }
 
 func (c *callbacks) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequest) error {
@@ -40,29 +104,63 @@ func (c *callbacks) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequ
 		return errors.New("node does not exist on the request")
 	}
 
-	ctx := context.Background()
+	c.streams.track(streamID, node.GetId())
+	c.inventory.RecordRequest(streamID, node, req.TypeUrl, req.ResourceNames, req.ResponseNonce, req.ErrorDetail)
+	c.metrics.ObserveStreamRequest(req.TypeUrl, req.ErrorDetail != nil)
 
-	switch req.TypeUrl {
+	return c.distribute(context.Background(), streamID, node, req.TypeUrl, req.ResourceNames)
+}
+
+// distribute registers the resource names requested by the node to the distributor and distributes them to the node.
+func (c *callbacks) distribute(ctx context.Context, streamID int64, n *core.Node, typeURL string, resourceNames []string) error {
+	node := n.GetId()
+
+	if err := c.uc.RegisterClientAttributesToDistributor(ctx, newClient(n)); err != nil {
+		c.logger.Error(err, "failed to register the attributes of the client to distributor", "streamID", streamID, "node", node)
+		return fmt.Errorf("failed to register the attributes of the client to the distributor: %w", err)
+	}
+
+	switch typeURL {
 	case resource.ListenerType:
-		if err := c.uc.RegisterClientToDistributor(ctx, node.Id, req.ResourceNames); err != nil {
-			c.logger.Error(err, "failed to register the client to distributor", "streamID", streamID, "node", node.Id)
+		if err := c.uc.RegisterClientToDistributor(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to register the client to distributor", "streamID", streamID, "node", node)
 			return fmt.Errorf("failed to register the client to the distributor: %w", err)
 		}
 
-		if err := c.uc.DistributeServicesToClient(ctx, node.Id, req.ResourceNames); err != nil {
-			c.logger.Error(err, "failed to distribute services to the client", "streamID", streamID, "node", node.Id)
+		if err := c.uc.DistributeServicesToClient(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to distribute services to the client", "streamID", streamID, "node", node)
 			return fmt.Errorf("failed to distribute services to the client: %w", err)
 		}
+	case resource.RouteType:
+		if err := c.uc.RegisterRoutesToDistributor(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to register the routes to distributor", "streamID", streamID, "node", node)
+			return fmt.Errorf("failed to register the routes to the distributor: %w", err)
+		}
+
+		if err := c.uc.DistributeRoutesToClient(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to distribute routes to the client", "streamID", streamID, "node", node)
+			return fmt.Errorf("failed to distribute routes to the client: %w", err)
+		}
 	case resource.ClusterType:
-		if err := c.uc.RegisterClustersToDistributor(ctx, node.Id, req.ResourceNames); err != nil {
-			c.logger.Error(err, "failed to register the clusters to distributor", "streamID", streamID, "node", node.Id)
+		if err := c.uc.RegisterClustersToDistributor(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to register the clusters to distributor", "streamID", streamID, "node", node)
 			return fmt.Errorf("failed to register the clusters to the distributor: %w", err)
 		}
 
-		if err := c.uc.DistributeClustersToClient(ctx, node.Id, req.ResourceNames); err != nil {
-			c.logger.Error(err, "failed to distribute clusters to the client", "streamID", streamID, "node", node.Id)
+		if err := c.uc.DistributeClustersToClient(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to distribute clusters to the client", "streamID", streamID, "node", node)
 			return fmt.Errorf("failed to distribute clusters to the client: %w", err)
 		}
+	case resource.EndpointType:
+		if err := c.uc.RegisterEndpointsToDistributor(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to register the endpoints to distributor", "streamID", streamID, "node", node)
+			return fmt.Errorf("failed to register the endpoints to the distributor: %w", err)
+		}
+
+		if err := c.uc.DistributeEndpointsToClient(ctx, node, resourceNames); err != nil {
+			c.logger.Error(err, "failed to distribute endpoints to the client", "streamID", streamID, "node", node)
+			return fmt.Errorf("failed to distribute endpoints to the client: %w", err)
+		}
 	}
 
 	return nil
@@ -70,31 +168,142 @@ func (c *callbacks) OnStreamRequest(streamID int64, req *discovery.DiscoveryRequ
 
 func (c *callbacks) OnStreamResponse(_ context.Context, streamID int64, req *discovery.DiscoveryRequest, res *discovery.DiscoveryResponse) {
 	c.logger.Info("stream response", "streamID", streamID, "request", req, "response", res)
+
+	c.inventory.RecordResponse(streamID, res.TypeUrl, res.VersionInfo, res.Nonce)
 }
 
-func (c callbacks) OnFetchRequest(_ context.Context, req *discovery.DiscoveryRequest) error {
-	c.logger.Info("fetch request")
-	return errors.New("fetch version of xDS is not supported")
+func (c *callbacks) OnFetchRequest(ctx context.Context, req *discovery.DiscoveryRequest) error {
+	c.logger.Info("fetch request", "type", req.TypeUrl, "request", req.ResourceNames, "version", req.VersionInfo)
+
+	node := req.GetNode()
+	if node == nil {
+		return errors.New("node does not exist on the request")
+	}
+
+	// NOTE: fetch clients are neither registered to the distributor nor distributed to, since nothing is pushed to them.
+	// Instead, the fetch cache generates the resources on every request so that the snapshots of the streams with the same node ID are kept intact.
+	switch req.TypeUrl {
+	case resource.ListenerType, resource.RouteType, resource.ClusterType, resource.EndpointType:
+		return nil
+	default:
+		return fmt.Errorf("fetch version of xDS does not support the type `%s`", req.TypeUrl)
+	}
 }
 
-func (c *callbacks) OnFetchResponse(req *discovery.DiscoveryRequest, _ *discovery.DiscoveryResponse) {
-	c.logger.Info("fetch response")
+func (c *callbacks) OnFetchResponse(req *discovery.DiscoveryRequest, res *discovery.DiscoveryResponse) {
+	c.logger.Info("fetch response", "type", req.TypeUrl, "node", req.GetNode().GetId(), "version", res.VersionInfo)
 }
 
 func (c *callbacks) OnDeltaStreamOpen(_ context.Context, streamID int64, _ string) error {
 	c.logger.Info("delta stream opened", "streamID", streamID)
-	return errors.New("delta version of xDS is not supported")
+
+	c.inventory.OpenStream(streamID, true)
+
+	c.deltaStreamsMu.Lock()
+	defer c.deltaStreamsMu.Unlock()
+
+	c.deltaStreamsMu.deltaStreams[streamID] = &deltaStream{
+		subscriptions: make(map[string]*stream.Subscription),
+	}
+
+	return nil
 }
 
 func (c *callbacks) OnDeltaStreamClosed(streamID int64, node *core.Node) {
 	c.logger.Info("delta stream closed", "streamID", streamID)
+
+	c.inventory.CloseStream(streamID)
+
+	c.deltaStreamsMu.Lock()
+	defer c.deltaStreamsMu.Unlock()
+
+	delete(c.deltaStreamsMu.deltaStreams, streamID)
+
+	c.streams.untrack(streamID)
+}
+
+func (c *callbacks) OnStreamDeltaRequest(streamID int64, req *discovery.DeltaDiscoveryRequest) error {
+	c.logger.Info("delta stream request", "type", req.TypeUrl, "streamID", streamID, "subscribe", req.ResourceNamesSubscribe, "unsubscribe", req.ResourceNamesUnsubscribe)
+
+	node, resourceNames, err := c.updateDeltaSubscription(streamID, req)
+	if err != nil {
+		return err
+	}
+
+	c.streams.track(streamID, node.GetId())
+	c.inventory.RecordRequest(streamID, node, req.TypeUrl, resourceNames, req.ResponseNonce, req.ErrorDetail)
+	c.metrics.ObserveStreamRequest(req.TypeUrl, req.ErrorDetail != nil)
+
+	return c.distribute(context.Background(), streamID, node, req.TypeUrl, resourceNames)
+}
+
+// updateDeltaSubscription applies the delta request to the subscription of the stream,
+// and returns the node and the resource names subscribed by the stream. The resource names are empty if the subscription is wildcard.
+func (c *callbacks) updateDeltaSubscription(streamID int64, req *discovery.DeltaDiscoveryRequest) (*core.Node, []string, error) {
+	c.deltaStreamsMu.Lock()
+	defer c.deltaStreamsMu.Unlock()
+
+	ds, ok := c.deltaStreamsMu.deltaStreams[streamID]
+	if !ok {
+		return nil, nil, fmt.Errorf("the delta stream `%d` is not opened", streamID)
+	}
+
+	// NOTE: the node is only guaranteed to be set on the first request of the stream.
+	if req.GetNode() != nil {
+		ds.node = req.GetNode()
+	}
+
+	if ds.node.GetId() == "" {
+		return nil, nil, errors.New("node does not exist on the request")
+	}
+
+	sub, ok := ds.subscriptions[req.TypeUrl]
+	if ok {
+		sub.UpdateResourceSubscriptions(req.ResourceNamesSubscribe, req.ResourceNamesUnsubscribe)
+	} else {
+		// NOTE: this must be consistent with the delta server which allows the legacy wildcard by default.
+		s := stream.NewDeltaSubscription(req.ResourceNamesSubscribe, req.ResourceNamesUnsubscribe, req.InitialResourceVersions, true)
+		sub = &s
+		ds.subscriptions[req.TypeUrl] = sub
+	}
+
+	if sub.IsWildcard() {
+		return ds.node, nil, nil
+	}
+
+	resourceNames := make([]string, 0, len(sub.SubscribedResources()))
+	for name := range sub.SubscribedResources() {
+		resourceNames = append(resourceNames, name)
+	}
+
+	sort.Strings(resourceNames)
+
+	return ds.node, resourceNames, nil
 }
 
-func (c *callbacks) OnStreamDeltaRequest(streamID int64, _ *discovery.DeltaDiscoveryRequest) error {
-	c.logger.Info("delta stream requested", "streamID", streamID)
-	return errors.New("delta version of xDS is not supported")
+func (c *callbacks) OnStreamDeltaResponse(streamID int64, _ *discovery.DeltaDiscoveryRequest, res *discovery.DeltaDiscoveryResponse) {
+	c.logger.Info("delta stream response", "streamID", streamID, "type", res.TypeUrl, "resources", len(res.Resources), "removed", res.RemovedResources)
+
+	c.inventory.RecordResponse(streamID, res.TypeUrl, res.SystemVersionInfo, res.Nonce)
 }
 
-func (c *callbacks) OnStreamDeltaResponse(streamID int64, _ *discovery.DeltaDiscoveryRequest, _ *discovery.DeltaDiscoveryResponse) {
-	c.logger.Info("delta stream response", "streamID", streamID)
+// newClient returns the client which has the attributes specified by the node metadata.
+func newClient(node *core.Node) *entity.Client {
+	client := &entity.Client{
+		ID:    node.GetId(),
+		Group: node.GetCluster(),
+		Envoy: node.GetUserAgentName() == envoyUserAgentName,
+	}
+
+	if g := node.GetMetadata().GetFields()[clientGroupMetadataKey].GetStringValue(); g != "" {
+		client.Group = g
+	}
+
+	v, ok := node.GetMetadata().GetFields()[proxylessSecurityMetadataKey]
+	if ok {
+		// NOTE: both of the bool value and the string value are accepted since some bootstraps can only have string metadata.
+		client.ProxylessSecurity = v.GetBoolValue() || strings.EqualFold(v.GetStringValue(), "true")
+	}
+
+	return client
 }
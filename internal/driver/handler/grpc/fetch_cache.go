@@ -0,0 +1,41 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
+)
+
+var _ cache.Cache = (*fetchCache)(nil)
+
+// Fetcher responds to a fetch request of the client with the resources generated from the services.
+type Fetcher interface {
+	Fetch(ctx context.Context, services []*entity.Service, client *entity.Client, req *cache.Request) (cache.Response, error)
+}
+
+// fetchCache serves the streams from the shared snapshot cache, and the fetch requests from the resources generated for each request,
+// so that a fetch client never mutates the snapshot cache.
+type fetchCache struct {
+	cache.SnapshotCache
+
+	uc      usecase.ServiceUseCase
+	fetcher Fetcher
+}
+
+func (c *fetchCache) Fetch(ctx context.Context, req *cache.Request) (cache.Response, error) {
+	services, err := c.uc.ListAllServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	res, err := c.fetcher.Fetch(ctx, services, newClient(req.GetNode()), req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch resources for the client `%s`: %w", req.GetNode().GetId(), err)
+	}
+
+	return res, nil
+}
@@ -4,26 +4,44 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"time"
 
+	cluster "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/service/route/v3"
 	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/go-logr/logr"
 	"google.golang.org/grpc"
 
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/inventory"
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/telemetry"
 	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
 )
 
-func NewServer(ctx context.Context, uc *usecase.ServiceUseCase, sc cache.SnapshotCache, port int, logger logr.Logger) *Server {
-	xdsServer := server.NewServer(ctx, sc, &callbacks{
+// NewXDSServer creates the xDS server shared by the gRPC server and the HTTP gateway.
+// The state of a client is cleaned up once cleanupGracePeriod has passed since all of its streams were closed.
+// The state of the streams is recorded to the inventory, and the fetch requests are responded by the fetcher without touching the snapshot cache.
+func NewXDSServer(ctx context.Context, uc *usecase.ServiceUseCase, sc cache.SnapshotCache, fetcher Fetcher, inv *inventory.Inventory, metrics *telemetry.Metrics, cleanupGracePeriod time.Duration, logger logr.Logger) server.Server {
+	fc := &fetchCache{
+		SnapshotCache: sc,
 		uc:            *uc,
-		snapshotCache: sc,
-		logger:        logger,
-	})
+		fetcher:       fetcher,
+	}
+
+	return server.NewServer(ctx, fc, newCallbacks(*uc, sc, inv, metrics, cleanupGracePeriod, logger))
+}
 
+func NewServer(xdsServer server.Server, port int) *Server {
 	grpcServer := grpc.NewServer()
 
 	discovery.RegisterAggregatedDiscoveryServiceServer(grpcServer, xdsServer)
+	listener.RegisterListenerDiscoveryServiceServer(grpcServer, xdsServer)
+	route.RegisterRouteDiscoveryServiceServer(grpcServer, xdsServer)
+	cluster.RegisterClusterDiscoveryServiceServer(grpcServer, xdsServer)
+	endpoint.RegisterEndpointDiscoveryServiceServer(grpcServer, xdsServer)
 
 	return &Server{
 		port:       port,
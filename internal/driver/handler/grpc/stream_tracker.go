@@ -0,0 +1,130 @@
+package grpc
+
+import (
+	"sync"
+	"time"
+)
+
+// streamTracker counts the opened streams of each node, and cleans up the node once the grace period has passed since its last stream was closed.
+// The grace period lets the node reconnect without losing its state, e.g. on a restart of the connection.
+type streamTracker struct {
+	gracePeriod time.Duration
+	cleanup     func(node string)
+
+	streamsMu struct {
+		sync.Mutex
+
+		// streamNodes is the node of each stream. A stream is tracked once its node is known by the first request.
+		streamNodes map[int64]string
+		nodeStreams map[string]int
+		timers      map[string]*time.Timer
+
+		// generation increases whenever a stream is tracked, and nodeGenerations is the generation of the last stream of each node,
+		// so that a pending cleanup is skipped if its node has tracked a stream since the cleanup was scheduled.
+		generation      uint64
+		nodeGenerations map[string]uint64
+
+		// cleanups are closed when the cleanup of each node, which runs without the lock, has finished.
+		cleanups map[string]chan struct{}
+	}
+}
+
+func newStreamTracker(gracePeriod time.Duration, cleanup func(node string)) *streamTracker {
+	t := &streamTracker{
+		gracePeriod: gracePeriod,
+		cleanup:     cleanup,
+	}
+
+	t.streamsMu.streamNodes = make(map[int64]string)
+	t.streamsMu.nodeStreams = make(map[string]int)
+	t.streamsMu.timers = make(map[string]*time.Timer)
+	t.streamsMu.nodeGenerations = make(map[string]uint64)
+	t.streamsMu.cleanups = make(map[string]chan struct{})
+
+	return t
+}
+
+// track counts the stream for the node, and cancels the pending cleanup of the node. Tracking the same stream again does nothing.
+// If the cleanup of the node is running, track waits for it so that the node is never registered in the middle of its cleanup.
+func (t *streamTracker) track(streamID int64, node string) {
+	if cleanup := t.trackStream(streamID, node); cleanup != nil {
+		<-cleanup
+	}
+}
+
+// trackStream counts the stream, and returns the channel of the running cleanup of the node if any.
+func (t *streamTracker) trackStream(streamID int64, node string) chan struct{} {
+	t.streamsMu.Lock()
+	defer t.streamsMu.Unlock()
+
+	if _, ok := t.streamsMu.streamNodes[streamID]; ok {
+		return nil
+	}
+
+	t.streamsMu.streamNodes[streamID] = node
+	t.streamsMu.nodeStreams[node]++
+
+	t.streamsMu.generation++
+	t.streamsMu.nodeGenerations[node] = t.streamsMu.generation
+
+	if timer, ok := t.streamsMu.timers[node]; ok {
+		timer.Stop()
+		delete(t.streamsMu.timers, node)
+	}
+
+	return t.streamsMu.cleanups[node]
+}
+
+// untrack uncounts the stream, and schedules the cleanup of its node if the stream was the last one of the node.
+func (t *streamTracker) untrack(streamID int64) {
+	t.streamsMu.Lock()
+	defer t.streamsMu.Unlock()
+
+	node, ok := t.streamsMu.streamNodes[streamID]
+	if !ok {
+		return
+	}
+
+	delete(t.streamsMu.streamNodes, streamID)
+
+	t.streamsMu.nodeStreams[node]--
+	if t.streamsMu.nodeStreams[node] > 0 {
+		return
+	}
+
+	delete(t.streamsMu.nodeStreams, node)
+
+	generation := t.streamsMu.nodeGenerations[node]
+
+	t.streamsMu.timers[node] = time.AfterFunc(t.gracePeriod, func() {
+		t.cleanupNode(node, generation)
+	})
+}
+
+// cleanupNode cleans up the node unless it has tracked a stream since the generation.
+// The cleanup runs without the lock so that it does not block the streams of the other nodes.
+func (t *streamTracker) cleanupNode(node string, generation uint64) {
+	t.streamsMu.Lock()
+
+	// NOTE: the node may have reconnected after the timer had fired but before the lock was acquired.
+	if t.streamsMu.nodeGenerations[node] != generation {
+		t.streamsMu.Unlock()
+		return
+	}
+
+	delete(t.streamsMu.timers, node)
+	delete(t.streamsMu.nodeGenerations, node)
+
+	done := make(chan struct{})
+	t.streamsMu.cleanups[node] = done
+
+	t.streamsMu.Unlock()
+
+	t.cleanup(node)
+
+	t.streamsMu.Lock()
+	delete(t.streamsMu.cleanups, node)
+	t.streamsMu.Unlock()
+
+	close(done)
+}
@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamTracker(t *testing.T) {
+	t.Parallel()
+
+	const gracePeriod = 50 * time.Millisecond
+
+	for name, test := range map[string]struct {
+		run         func(t *streamTracker)
+		wantCleanup bool
+	}{
+		"should clean up the node after the last stream is closed": {
+			run: func(t *streamTracker) {
+				t.track(1, "node-1")
+				t.track(2, "node-1")
+				t.untrack(1)
+				t.untrack(2)
+			},
+			wantCleanup: true,
+		},
+		"should not clean up the node while it has an opened stream": {
+			run: func(t *streamTracker) {
+				t.track(1, "node-1")
+				t.track(2, "node-1")
+				t.untrack(1)
+			},
+			wantCleanup: false,
+		},
+		"should not clean up the node if it reconnects within the grace period": {
+			run: func(t *streamTracker) {
+				t.track(1, "node-1")
+				t.untrack(1)
+				t.track(2, "node-1")
+			},
+			wantCleanup: false,
+		},
+		"should count the stream only once even if it is tracked on every request": {
+			run: func(t *streamTracker) {
+				t.track(1, "node-1")
+				t.track(1, "node-1")
+				t.untrack(1)
+			},
+			wantCleanup: true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cleaned := make(chan string, 1)
+			tracker := newStreamTracker(gracePeriod, func(node string) {
+				cleaned <- node
+			})
+
+			test.run(tracker)
+
+			select {
+			case node := <-cleaned:
+				if !test.wantCleanup {
+					t.Errorf("want no cleanup, got the cleanup of %s", node)
+				}
+				if node != "node-1" {
+					t.Errorf("want node-1, got %s", node)
+				}
+			case <-time.After(gracePeriod * 4):
+				if test.wantCleanup {
+					t.Error("want the cleanup of node-1, got no cleanup")
+				}
+			}
+		})
+	}
+}
+
+func TestStreamTracker_ReconnectDuringCleanup(t *testing.T) {
+	t.Parallel()
+
+	const gracePeriod = 50 * time.Millisecond
+
+	startedCh := make(chan struct{}, 1)
+	releaseCh := make(chan struct{})
+	cleaned := make(chan string, 2)
+
+	tracker := newStreamTracker(gracePeriod, func(node string) {
+		startedCh <- struct{}{}
+		<-releaseCh
+		cleaned <- node
+	})
+
+	tracker.track(1, "node-1")
+	tracker.untrack(1)
+
+	<-startedCh
+
+	trackedCh := make(chan struct{})
+	go func() {
+		tracker.track(2, "node-1")
+		close(trackedCh)
+	}()
+
+	select {
+	case <-trackedCh:
+		t.Fatal("want the reconnection to wait for the cleanup, got it tracked during the cleanup")
+	case <-time.After(gracePeriod):
+	}
+
+	otherTrackedCh := make(chan struct{})
+	go func() {
+		tracker.track(3, "node-2")
+		close(otherTrackedCh)
+	}()
+
+	select {
+	case <-otherTrackedCh:
+	case <-time.After(gracePeriod):
+		t.Fatal("want the other node to be tracked during the cleanup, got it blocked")
+	}
+
+	close(releaseCh)
+	<-trackedCh
+
+	if node := <-cleaned; node != "node-1" {
+		t.Errorf("want node-1, got %s", node)
+	}
+
+	select {
+	case node := <-cleaned:
+		t.Errorf("want no cleanup of the reconnected node, got the cleanup of %s", node)
+	case <-time.After(gracePeriod * 4):
+	}
+
+	tracker.untrack(2)
+
+	select {
+	case node := <-cleaned:
+		if node != "node-1" {
+			t.Errorf("want node-1, got %s", node)
+		}
+	case <-time.After(gracePeriod * 4):
+		t.Error("want the cleanup of node-1 after the reconnected stream is closed, got no cleanup")
+	}
+}
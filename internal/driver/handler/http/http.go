@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/go-logr/logr"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/httpserver"
+)
+
+// NewServer creates the HTTP server which serves the REST version of xDS (e.g. `/v3/discovery:listeners`) for polling clients.
+func NewServer(xdsServer server.Server, port int, logger logr.Logger) *httpserver.Server {
+	mux := http.NewServeMux()
+
+	mux.Handle("/v3/", &xdsHandler{
+		gateway: &server.HTTPGateway{Server: xdsServer},
+		logger:  logger,
+	})
+
+	return httpserver.NewServer(mux, port)
+}
+
+type xdsHandler struct {
+	gateway *server.HTTPGateway
+	logger  logr.Logger
+}
+
+func (h *xdsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, code, err := h.gateway.ServeHTTP(r)
+	if err != nil {
+		h.logger.Error(err, "failed to serve the xDS request", "path", r.URL.Path, "code", code)
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if body == nil {
+		w.WriteHeader(code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if _, err := w.Write(body); err != nil {
+		h.logger.Error(err, "failed to write the response", "path", r.URL.Path)
+	}
+}
@@ -0,0 +1,38 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// NewServer creates the HTTP server which serves the handler on the port, and is started and stopped by a server group.
+func NewServer(handler http.Handler, port int) *Server {
+	return &Server{
+		httpServer: &http.Server{
+			Addr:    fmt.Sprintf(":%d", port),
+			Handler: handler,
+		},
+	}
+}
+
+type Server struct {
+	httpServer *http.Server
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("the server has aborted : %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown the server: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/driver/handler/httpserver"
+)
+
+// NewServer creates the HTTP server which serves `GET /metrics` by the handler exposing the metrics in the Prometheus format.
+func NewServer(handler http.Handler, port int) *httpserver.Server {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /metrics", handler)
+
+	return httpserver.NewServer(mux, port)
+}
@@ -0,0 +1,245 @@
+package inventory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// Inventory holds the state of the xDS streams of the connected clients, which is recorded by the xDS callbacks, for inspection.
+type Inventory struct {
+	streamsMu struct {
+		sync.RWMutex
+		streams map[int64]*stream
+	}
+}
+
+type stream struct {
+	id       int64
+	delta    bool
+	openedAt time.Time
+
+	// node is nil until the first request of the stream is received.
+	node *core.Node
+
+	resourceTypes map[string]*resourceType
+}
+
+type resourceType struct {
+	requested []string
+
+	sentVersion string
+	sentNonce   string
+
+	ackedVersion string
+	nackError    string
+}
+
+func NewInventory() *Inventory {
+	i := &Inventory{}
+
+	i.streamsMu.streams = make(map[int64]*stream)
+
+	return i
+}
+
+// OpenStream records the stream. delta is true if the stream is a delta xDS stream.
+func (i *Inventory) OpenStream(streamID int64, delta bool) {
+	i.streamsMu.Lock()
+	defer i.streamsMu.Unlock()
+
+	i.streamsMu.streams[streamID] = &stream{
+		id:            streamID,
+		delta:         delta,
+		openedAt:      time.Now(),
+		resourceTypes: make(map[string]*resourceType),
+	}
+}
+
+func (i *Inventory) CloseStream(streamID int64) {
+	i.streamsMu.Lock()
+	defer i.streamsMu.Unlock()
+
+	delete(i.streamsMu.streams, streamID)
+}
+
+// RecordRequest records the resource names requested on the stream, and whether the last response has been ACKed or NACKed by the request.
+// The node can be nil since it is only guaranteed to be sent on the first request of the stream.
+func (i *Inventory) RecordRequest(streamID int64, node *core.Node, typeURL string, resourceNames []string, responseNonce string, errorDetail *status.Status) {
+	i.streamsMu.Lock()
+	defer i.streamsMu.Unlock()
+
+	s, ok := i.streamsMu.streams[streamID]
+	if !ok {
+		return
+	}
+
+	if node != nil {
+		s.node = node
+	}
+
+	rt := s.resourceType(typeURL)
+	rt.requested = resourceNames
+
+	// NOTE: the request which does not refer to the last response (e.g. the initial request) is neither an ACK nor a NACK.
+	if responseNonce == "" || responseNonce != rt.sentNonce {
+		return
+	}
+
+	if errorDetail != nil {
+		rt.nackError = errorDetail.GetMessage()
+		return
+	}
+
+	rt.ackedVersion = rt.sentVersion
+	rt.nackError = ""
+}
+
+// RecordResponse records the version and the nonce of the response sent on the stream.
+func (i *Inventory) RecordResponse(streamID int64, typeURL string, version string, nonce string) {
+	i.streamsMu.Lock()
+	defer i.streamsMu.Unlock()
+
+	s, ok := i.streamsMu.streams[streamID]
+	if !ok {
+		return
+	}
+
+	rt := s.resourceType(typeURL)
+	rt.sentVersion = version
+	rt.sentNonce = nonce
+}
+
+func (s *stream) resourceType(typeURL string) *resourceType {
+	rt, ok := s.resourceTypes[typeURL]
+	if !ok {
+		rt = &resourceType{}
+		s.resourceTypes[typeURL] = rt
+	}
+
+	return rt
+}
+
+// Client is the client connected with the streams.
+type Client struct {
+	ID string
+
+	// Node is the node sent on the latest opened stream of the client.
+	Node *core.Node
+
+	Streams []*Stream
+}
+
+type Stream struct {
+	ID       int64
+	Delta    bool
+	OpenedAt time.Time
+
+	// ResourceTypes are the states of the resources by the type URL.
+	ResourceTypes map[string]*ResourceType
+}
+
+type ResourceType struct {
+	// RequestedNames are the resource names requested by the client. Empty means that all resources are requested.
+	RequestedNames []string
+
+	LastSentVersion  string
+	LastAckedVersion string
+
+	// LastNackError is the error of the last NACK, which is cleared by an ACK.
+	LastNackError string
+}
+
+// Clients returns the connected clients sorted by their IDs. The streams whose nodes are not known yet are not included.
+func (i *Inventory) Clients() []*Client {
+	i.streamsMu.RLock()
+	defer i.streamsMu.RUnlock()
+
+	clients := make(map[string]*Client)
+	latestStreams := make(map[string]int64)
+
+	for _, s := range i.streamsMu.streams {
+		if s.node == nil {
+			continue
+		}
+
+		c, ok := clients[s.node.GetId()]
+		if !ok {
+			c = &Client{ID: s.node.GetId()}
+			clients[c.ID] = c
+		}
+
+		c.Streams = append(c.Streams, s.toStream())
+
+		if latest, ok := latestStreams[c.ID]; !ok || s.id > latest {
+			latestStreams[c.ID] = s.id
+			c.Node = s.node
+		}
+	}
+
+	out := make([]*Client, 0, len(clients))
+	for _, c := range clients {
+		sort.SliceStable(c.Streams, func(x, y int) bool {
+			return c.Streams[x].ID < c.Streams[y].ID
+		})
+
+		out = append(out, c)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return strings.Compare(out[i].ID, out[j].ID) < 0
+	})
+
+	return out
+}
+
+// Client returns the connected client with the ID, or false if the client is not connected.
+func (i *Inventory) Client(id string) (*Client, bool) {
+	for _, c := range i.Clients() {
+		if c.ID == id {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *stream) toStream() *Stream {
+	out := &Stream{
+		ID:            s.id,
+		Delta:         s.delta,
+		OpenedAt:      s.openedAt,
+		ResourceTypes: make(map[string]*ResourceType, len(s.resourceTypes)),
+	}
+
+	for typeURL, rt := range s.resourceTypes {
+		out.ResourceTypes[typeURL] = &ResourceType{
+			RequestedNames:   rt.requested,
+			LastSentVersion:  rt.sentVersion,
+			LastAckedVersion: rt.ackedVersion,
+			LastNackError:    rt.nackError,
+		}
+	}
+
+	return out
+}
+
+// OpenStreamsByType returns the number of the opened streams by the type URL requested on them.
+// A stream is counted for each type URL since an ADS stream can request multiple types.
+func (i *Inventory) OpenStreamsByType() map[string]int {
+	i.streamsMu.RLock()
+	defer i.streamsMu.RUnlock()
+
+	out := make(map[string]int)
+	for _, s := range i.streamsMu.streams {
+		for typeURL := range s.resourceTypes {
+			out[typeURL]++
+		}
+	}
+
+	return out
+}
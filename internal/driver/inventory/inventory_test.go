@@ -0,0 +1,133 @@
+package inventory
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/genproto/googleapis/rpc/status"
+)
+
+func TestInventoryClients(t *testing.T) {
+	t.Parallel()
+
+	node := &core.Node{Id: "node-1"}
+
+	for name, test := range map[string]struct {
+		record func(i *Inventory)
+		want   *ResourceType
+	}{
+		"should record the requested names and the sent version before the response is ACKed": {
+			record: func(i *Inventory) {
+				i.RecordRequest(1, node, resource.ListenerType, []string{"service-1"}, "", nil)
+				i.RecordResponse(1, resource.ListenerType, "v1", "nonce-1")
+			},
+			want: &ResourceType{
+				RequestedNames:  []string{"service-1"},
+				LastSentVersion: "v1",
+			},
+		},
+		"should record the ACKed version": {
+			record: func(i *Inventory) {
+				i.RecordRequest(1, node, resource.ListenerType, []string{"service-1"}, "", nil)
+				i.RecordResponse(1, resource.ListenerType, "v1", "nonce-1")
+				i.RecordRequest(1, nil, resource.ListenerType, []string{"service-1"}, "nonce-1", nil)
+			},
+			want: &ResourceType{
+				RequestedNames:   []string{"service-1"},
+				LastSentVersion:  "v1",
+				LastAckedVersion: "v1",
+			},
+		},
+		"should keep the ACKed version and record the error on NACK": {
+			record: func(i *Inventory) {
+				i.RecordRequest(1, node, resource.ListenerType, []string{"service-1"}, "", nil)
+				i.RecordResponse(1, resource.ListenerType, "v1", "nonce-1")
+				i.RecordRequest(1, nil, resource.ListenerType, []string{"service-1"}, "nonce-1", nil)
+				i.RecordResponse(1, resource.ListenerType, "v2", "nonce-2")
+				i.RecordRequest(1, nil, resource.ListenerType, []string{"service-1"}, "nonce-2", &status.Status{Message: "invalid listener"})
+			},
+			want: &ResourceType{
+				RequestedNames:   []string{"service-1"},
+				LastSentVersion:  "v2",
+				LastAckedVersion: "v1",
+				LastNackError:    "invalid listener",
+			},
+		},
+		"should not treat the request with a stale nonce as an ACK": {
+			record: func(i *Inventory) {
+				i.RecordRequest(1, node, resource.ListenerType, nil, "", nil)
+				i.RecordResponse(1, resource.ListenerType, "v1", "nonce-1")
+				i.RecordResponse(1, resource.ListenerType, "v2", "nonce-2")
+				i.RecordRequest(1, nil, resource.ListenerType, nil, "nonce-1", nil)
+			},
+			want: &ResourceType{
+				LastSentVersion: "v2",
+			},
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			i := NewInventory()
+			i.OpenStream(1, false)
+
+			test.record(i)
+
+			c, ok := i.Client("node-1")
+			if !ok {
+				t.Fatal("want the client node-1, got nothing")
+			}
+
+			if len(c.Streams) != 1 {
+				t.Fatalf("want 1 stream, got %d", len(c.Streams))
+			}
+
+			got := c.Streams[0].ResourceTypes[resource.ListenerType]
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n(-got, +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInventoryClients_Streams(t *testing.T) {
+	t.Parallel()
+
+	i := NewInventory()
+	i.OpenStream(1, false)
+	i.OpenStream(2, true)
+	i.OpenStream(3, false)
+
+	i.RecordRequest(1, &core.Node{Id: "node-1", Cluster: "old"}, resource.ListenerType, nil, "", nil)
+	i.RecordRequest(2, &core.Node{Id: "node-1", Cluster: "new"}, resource.ClusterType, nil, "", nil)
+	// NOTE: stream 3 is not listed since no request has been received on it.
+
+	clients := i.Clients()
+	if len(clients) != 1 {
+		t.Fatalf("want 1 client, got %d", len(clients))
+	}
+
+	if got := clients[0].Node.GetCluster(); got != "new" {
+		t.Errorf("want the node of the latest stream, got the cluster %s", got)
+	}
+
+	var ids []int64
+	for _, s := range clients[0].Streams {
+		ids = append(ids, s.ID)
+	}
+
+	if diff := cmp.Diff(ids, []int64{1, 2}); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+
+	i.CloseStream(1)
+	i.CloseStream(2)
+
+	if _, ok := i.Client("node-1"); ok {
+		t.Error("want no client after all streams are closed, got node-1")
+	}
+}
@@ -7,9 +7,23 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-func NewLogger() (logr.Logger, error) {
+// Verbosity is the maximum verbosity of the logs emitted by the logger, i.e. `logger.V(n)` is emitted only if n does not exceed it.
+// It can be changed after the logger is created since the verbosity is given by the flag which is parsed after that.
+type Verbosity struct {
+	level zap.AtomicLevel
+}
+
+// Set changes the maximum verbosity. Zero emits only the info and the error logs.
+func (v Verbosity) Set(verbosity int) {
+	// NOTE: zapr maps `V(n)` to the zap level `-n`.
+	v.level.SetLevel(zapcore.Level(-verbosity))
+}
+
+func NewLogger() (logr.Logger, Verbosity, error) {
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+
 	config := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zap.InfoLevel),
+		Level:             level,
 		Development:       false,
 		Encoding:          "json",
 		DisableCaller:     true,
@@ -30,8 +44,8 @@ func NewLogger() (logr.Logger, error) {
 
 	l, err := config.Build()
 	if err != nil {
-		return logr.Logger{}, err
+		return logr.Logger{}, Verbosity{}, err
 	}
 
-	return zapr.NewLogger(l), nil
+	return zapr.NewLogger(l), Verbosity{level: level}, nil
 }
@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+const namespace = "cloud_run_service_router"
+
+// Metrics are the Prometheus metrics of the control plane.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	listServicesDuration *prometheus.HistogramVec
+	listServicesErrors   *prometheus.CounterVec
+	services             *prometheus.GaugeVec
+	distributionDuration prometheus.Histogram
+	distributionClients  *prometheus.CounterVec
+	streamRequests       *prometheus.CounterVec
+	streamNacks          *prometheus.CounterVec
+
+	// refreshedAt is the unix time in nanoseconds when the snapshots were confirmed to be up to date for the last time,
+	// or when the metrics were created if they have never been confirmed.
+	refreshedAt atomic.Int64
+
+	// distributionFailed is whether the last distribution failed or skipped any client.
+	// A refresh of services does not confirm the snapshots while it is true, since the failed clients have stale snapshots.
+	distributionFailed atomic.Bool
+}
+
+// NewMetrics creates the metrics. openStreams returns the number of the opened xDS streams by the type URL, which is called on every scrape.
+func NewMetrics(openStreams func() map[string]int) (*Metrics, error) {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		listServicesDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "list_services_duration_seconds",
+			Help:      "Latency of listing Cloud Run services of a parent (a pair of a project and a location).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"parent"}),
+		listServicesErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "list_services_errors_total",
+			Help:      "Number of failures of listing Cloud Run services of a parent.",
+		}, []string{"parent"}),
+		services: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "services",
+			Help:      "Number of the discovered services by the kind, `origin` or `route`.",
+		}, []string{"kind"}),
+		distributionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "distribution_duration_seconds",
+			Help:      "Latency of distributing services to all affected clients.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		distributionClients: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "distribution_clients_total",
+			Help:      "Number of clients to which services are distributed by the result, `succeeded`, `failed` or `skipped`.",
+		}, []string{"result"}),
+		streamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_requests_total",
+			Help:      "Number of xDS requests received on streams by the type URL.",
+		}, []string{"type_url"}),
+		streamNacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stream_nacks_total",
+			Help:      "Number of xDS requests which reject the previous response (NACK) by the type URL.",
+		}, []string{"type_url"}),
+	}
+
+	m.refreshedAt.Store(time.Now().UnixNano())
+
+	snapshotAge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "snapshot_age_seconds",
+		Help:      "Seconds since the snapshots were confirmed to be up to date by a successful refresh of services without failed clients, or by a distribution to all clients.",
+	}, func() float64 {
+		return time.Since(time.Unix(0, m.refreshedAt.Load())).Seconds()
+	})
+
+	for _, c := range []prometheus.Collector{
+		m.listServicesDuration,
+		m.listServicesErrors,
+		m.services,
+		m.distributionDuration,
+		m.distributionClients,
+		m.streamRequests,
+		m.streamNacks,
+		snapshotAge,
+		newOpenStreamsCollector(openStreams),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := m.registry.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register the collector: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Handler returns the HTTP handler which exposes the metrics in the Prometheus format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveListServices records the latency of listing services of the parent, and counts the error if it is not nil.
+func (m *Metrics) ObserveListServices(parent string, duration time.Duration, err error) {
+	m.listServicesDuration.WithLabelValues(parent).Observe(duration.Seconds())
+
+	if err != nil {
+		m.listServicesErrors.WithLabelValues(parent).Inc()
+	}
+}
+
+// ObserveRefresh records the number of the discovered services on a successful refresh of services,
+// which confirms the snapshots to be up to date unless the last distribution failed.
+func (m *Metrics) ObserveRefresh(originServices, routeServices int) {
+	m.services.WithLabelValues("origin").Set(float64(originServices))
+	m.services.WithLabelValues("route").Set(float64(routeServices))
+
+	if !m.distributionFailed.Load() {
+		m.refreshedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// ObserveDistribution records the latency and the result of distributing services to clients.
+// The distribution confirms the snapshots to be up to date if no client has failed or been skipped.
+func (m *Metrics) ObserveDistribution(duration time.Duration, result *entity.DistributionResult) {
+	m.distributionDuration.Observe(duration.Seconds())
+
+	m.distributionClients.WithLabelValues("succeeded").Add(float64(result.Succeeded))
+	m.distributionClients.WithLabelValues("failed").Add(float64(result.Failed))
+	m.distributionClients.WithLabelValues("skipped").Add(float64(result.Skipped))
+
+	failed := result.Failed > 0 || result.Skipped > 0
+	m.distributionFailed.Store(failed)
+
+	if !failed {
+		m.refreshedAt.Store(time.Now().UnixNano())
+	}
+}
+
+// ObserveStreamRequest counts the xDS request of the type URL. nack is true if the request rejects the previous response.
+func (m *Metrics) ObserveStreamRequest(typeURL string, nack bool) {
+	m.streamRequests.WithLabelValues(typeURL).Inc()
+
+	if nack {
+		m.streamNacks.WithLabelValues(typeURL).Inc()
+	}
+}
+
+// openStreamsCollector collects the number of the opened streams on every scrape so that it is always consistent with the streams.
+type openStreamsCollector struct {
+	desc        *prometheus.Desc
+	openStreams func() map[string]int
+}
+
+func newOpenStreamsCollector(openStreams func() map[string]int) *openStreamsCollector {
+	return &openStreamsCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "open_streams"),
+			"Number of the opened xDS streams by the type URL requested on them.",
+			[]string{"type_url"},
+			nil,
+		),
+		openStreams: openStreams,
+	}
+}
+
+func (c *openStreamsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *openStreamsCollector) Collect(ch chan<- prometheus.Metric) {
+	for typeURL, n := range c.openStreams() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), typeURL)
+	}
+}
@@ -0,0 +1,132 @@
+package telemetry
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewMetrics(func() map[string]int {
+		return map[string]int{resource.ListenerType: 2}
+	})
+	if err != nil {
+		t.Fatalf("failed to create the metrics: %s", err)
+	}
+
+	m.ObserveListServices("projects/test-project/locations/test-location", time.Second, errors.New("unavailable"))
+	m.ObserveRefresh(2, 3)
+	m.ObserveDistribution(time.Second, &entity.DistributionResult{Succeeded: 2, Failed: 1})
+	m.ObserveStreamRequest(resource.ListenerType, false)
+	m.ObserveStreamRequest(resource.ListenerType, true)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	b, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("failed to read the body: %s", err)
+	}
+
+	body := string(b)
+
+	for _, want := range []string{
+		`cloud_run_service_router_list_services_duration_seconds_count{parent="projects/test-project/locations/test-location"} 1`,
+		`cloud_run_service_router_list_services_errors_total{parent="projects/test-project/locations/test-location"} 1`,
+		`cloud_run_service_router_services{kind="origin"} 2`,
+		`cloud_run_service_router_services{kind="route"} 3`,
+		`cloud_run_service_router_distribution_duration_seconds_count 1`,
+		`cloud_run_service_router_distribution_clients_total{result="succeeded"} 2`,
+		`cloud_run_service_router_distribution_clients_total{result="failed"} 1`,
+		`cloud_run_service_router_stream_requests_total{type_url="` + resource.ListenerType + `"} 2`,
+		`cloud_run_service_router_stream_nacks_total{type_url="` + resource.ListenerType + `"} 1`,
+		`cloud_run_service_router_open_streams{type_url="` + resource.ListenerType + `"} 2`,
+		`cloud_run_service_router_snapshot_age_seconds`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want the metric `%s`, got\n%s", want, body)
+		}
+	}
+}
+
+func TestSnapshotAge(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		observe   func(m *Metrics)
+		wantReset bool
+	}{
+		"should be reset by a refresh": {
+			observe: func(m *Metrics) {
+				m.ObserveRefresh(1, 0)
+			},
+			wantReset: true,
+		},
+		"should be reset by a distribution to all clients": {
+			observe: func(m *Metrics) {
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Succeeded: 2})
+			},
+			wantReset: true,
+		},
+		"should not be reset by a distribution with a failed client": {
+			observe: func(m *Metrics) {
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Succeeded: 1, Failed: 1})
+			},
+			wantReset: false,
+		},
+		"should not be reset by a distribution with a skipped client": {
+			observe: func(m *Metrics) {
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Succeeded: 1, Skipped: 1})
+			},
+			wantReset: false,
+		},
+		"should not be reset by a refresh after a failed distribution": {
+			observe: func(m *Metrics) {
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Failed: 1})
+				m.ObserveRefresh(1, 0)
+			},
+			wantReset: false,
+		},
+		"should be reset by a refresh after the failed clients are distributed": {
+			observe: func(m *Metrics) {
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Failed: 1})
+				m.ObserveDistribution(time.Second, &entity.DistributionResult{Succeeded: 1})
+				m.ObserveRefresh(1, 0)
+			},
+			wantReset: true,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := NewMetrics(func() map[string]int { return nil })
+			if err != nil {
+				t.Fatalf("failed to create the metrics: %s", err)
+			}
+
+			created := time.Now().Add(-time.Hour).UnixNano()
+			m.refreshedAt.Store(created)
+
+			test.observe(m)
+
+			if got := m.refreshedAt.Load() != created; got != test.wantReset {
+				t.Errorf("want %v, got %v", test.wantReset, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serviceName = "cloud-run-service-router-xds"
+
+// NewOTLPExporter creates the exporter which exports spans via OTLP over gRPC.
+// The exporter is configured by the standard environment variables such as `OTEL_EXPORTER_OTLP_ENDPOINT`.
+func NewOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the otlp exporter: %w", err)
+	}
+
+	return exporter, nil
+}
+
+// NewTracerProvider creates the tracer provider which exports spans by the exporter in batches.
+// The service name can be overridden by `OTEL_SERVICE_NAME`, and the sampler can be configured by `OTEL_TRACES_SAMPLER`.
+func NewTracerProvider(ctx context.Context, exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	// NOTE: the resource detected from the environment variables takes precedence over the default service name.
+	res, err := resource.New(
+		ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	for name, test := range map[string]struct {
+		env  string
+		want string
+	}{
+		"should use the default service name": {
+			want: serviceName,
+		},
+		"should use the service name from the environment variable": {
+			env:  "custom-service",
+			want: "custom-service",
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			// NOTE: t.Setenv can not be used in parallel tests.
+			t.Setenv("OTEL_SERVICE_NAME", test.env)
+
+			ctx := context.Background()
+
+			exporter := tracetest.NewInMemoryExporter()
+
+			tp, err := NewTracerProvider(ctx, exporter)
+			if err != nil {
+				t.Fatalf("failed to create the tracer provider: %s", err)
+			}
+
+			defer func() {
+				if err := tp.Shutdown(ctx); err != nil {
+					t.Errorf("failed to shutdown the tracer provider: %s", err)
+				}
+			}()
+
+			_, span := tp.Tracer("test").Start(ctx, "span")
+			span.End()
+
+			// NOTE: spans are exported in batches, and the in-memory exporter discards them on shutdown.
+			if err := tp.ForceFlush(ctx); err != nil {
+				t.Fatalf("failed to flush spans: %s", err)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("want 1 span, got %d", len(spans))
+			}
+
+			var got string
+			for _, attr := range spans[0].Resource.Attributes() {
+				if attr.Key == "service.name" {
+					got = attr.Value.AsString()
+				}
+			}
+
+			if got != test.want {
+				t.Errorf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package debouncer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
+	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
+)
+
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/driver/worker/debouncer")
+
+// ServiceRefreshDebouncer refreshes services once for the triggers within the delay,
+// so that a burst of change notifications does not result in a burst of Cloud Run API calls.
+type ServiceRefreshDebouncer struct {
+	uc     *usecase.ServiceUseCase
+	logger logr.Logger
+	delay  time.Duration
+
+	triggerCh chan struct{}
+}
+
+func NewServiceRefreshDebouncer(uc *usecase.ServiceUseCase, delay time.Duration, logger logr.Logger) *ServiceRefreshDebouncer {
+	return &ServiceRefreshDebouncer{
+		uc:     uc,
+		logger: logger,
+		delay:  delay,
+
+		// NOTE: the buffer holds a pending trigger, so triggers while refreshing result in exactly one more refresh.
+		triggerCh: make(chan struct{}, 1),
+	}
+}
+
+// Trigger requests the debouncer to refresh services. It never blocks.
+func (d *ServiceRefreshDebouncer) Trigger() {
+	select {
+	case d.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+func (d *ServiceRefreshDebouncer) refresh(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "ServiceRefreshDebouncer.refresh")
+	defer span.End()
+
+	if err := d.uc.RefreshServices(ctx); err != nil {
+		return tracing.RecordError(span, fmt.Errorf("failed to refresh services: %w", err))
+	}
+
+	return nil
+}
+
+// Start refreshes services for the triggers until ctx is done.
+// NOTE: the trigger pending when ctx is done is dropped, since the broker is shutting down and the next process refreshes services on start anyway.
+func (d *ServiceRefreshDebouncer) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-d.triggerCh:
+		case <-ctx.Done():
+			return nil
+		}
+
+		// NOTE: the triggers during the delay are coalesced into the first one.
+		timer := time.NewTimer(d.delay)
+
+	wait:
+		for {
+			select {
+			case <-d.triggerCh:
+			case <-timer.C:
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			}
+		}
+
+		if err := d.refresh(ctx); err != nil {
+			d.logger.Error(err, "failed to refresh services")
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package debouncer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/distributor"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/repository"
+	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
+)
+
+var (
+	_ repository.ServiceRepository   = (*testServiceRepository)(nil)
+	_ distributor.ServiceDistributor = (*testServiceDistributor)(nil)
+)
+
+// testServiceRepository counts the refreshes. The refreshes return no difference, so that no event is published.
+type testServiceRepository struct {
+	repository.ServiceRepository
+
+	refreshes atomic.Int32
+}
+
+func (r *testServiceRepository) RefreshServices(ctx context.Context) (*entity.ServiceDiff, error) {
+	r.refreshes.Add(1)
+	return &entity.ServiceDiff{}, nil
+}
+
+func (r *testServiceRepository) ListAllServices(ctx context.Context) ([]*entity.Service, error) {
+	return nil, nil
+}
+
+// testServiceDistributor has no failed clients.
+type testServiceDistributor struct {
+	distributor.ServiceDistributor
+}
+
+func (d *testServiceDistributor) DistributeServicesToFailedClients(ctx context.Context, services []*entity.Service) (*entity.DistributionResult, error) {
+	return &entity.DistributionResult{}, nil
+}
+
+func TestServiceRefreshDebouncer_Coalesce(t *testing.T) {
+	t.Parallel()
+
+	repo := new(testServiceRepository)
+	d := NewServiceRefreshDebouncer(usecase.NewServiceUseCase(nil, new(testServiceDistributor), repo), 200*time.Millisecond, logr.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = d.Start(ctx)
+	}()
+
+	for i := 0; i < 10; i++ {
+		d.Trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if got := repo.refreshes.Load(); got != 1 {
+		t.Errorf("want %v, got %v", 1, got)
+	}
+}
+
+func TestServiceRefreshDebouncer_DropOnStop(t *testing.T) {
+	t.Parallel()
+
+	repo := new(testServiceRepository)
+	d := NewServiceRefreshDebouncer(usecase.NewServiceUseCase(nil, new(testServiceDistributor), repo), time.Hour, logr.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	startedCh := make(chan error)
+	go func() {
+		startedCh <- d.Start(ctx)
+	}()
+
+	d.Trigger()
+
+	// NOTE: the debouncer is stopped long before the delay of an hour elapses.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-startedCh; err != nil {
+		t.Errorf("failed to start the debouncer: %s", err)
+		return
+	}
+
+	if got := repo.refreshes.Load(); got != 0 {
+		t.Errorf("want %v, got %v", 0, got)
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
 
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
 	"github.com/kauche/cloud-run-service-router-xds/internal/usecase"
 )
 
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/driver/worker/ticker")
+
 type ServiceRefreshTicker struct {
 	uc         *usecase.ServiceUseCase
 	logger     logr.Logger
@@ -25,8 +29,11 @@ func NewServiceRefreshTicker(uc *usecase.ServiceUseCase, syncPeriod time.Duratio
 }
 
 func (t *ServiceRefreshTicker) tick(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "ServiceRefreshTicker.tick")
+	defer span.End()
+
 	if err := t.uc.RefreshServices(ctx); err != nil {
-		return fmt.Errorf("failed to refresh services: %w", err)
+		return tracing.RecordError(span, fmt.Errorf("failed to refresh services: %w", err))
 	}
 
 	return nil
@@ -1,31 +1,50 @@
 package e2etest
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
 	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	cds "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	eds "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	lds "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	"github.com/golang/protobuf/ptypes/duration"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-var client discovery.AggregatedDiscoveryServiceClient
+var (
+	client         discovery.AggregatedDiscoveryServiceClient
+	listenerClient lds.ListenerDiscoveryServiceClient
+	clusterClient  cds.ClusterDiscoveryServiceClient
+	endpointClient eds.EndpointDiscoveryServiceClient
+)
 
 var cmpoptSortListeners = cmpopts.SortSlices(func(x, y *listener.Listener) bool {
 	return strings.Compare(x.Name, y.Name) < 0
@@ -49,6 +68,9 @@ func TestMain(m *testing.M) {
 		defer cc.Close()
 
 		client = discovery.NewAggregatedDiscoveryServiceClient(cc)
+		listenerClient = lds.NewListenerDiscoveryServiceClient(cc)
+		clusterClient = cds.NewClusterDiscoveryServiceClient(cc)
+		endpointClient = eds.NewEndpointDiscoveryServiceClient(cc)
 
 		return m.Run()
 	}())
@@ -92,7 +114,7 @@ func TestE2E_ListSpecificListeners(t *testing.T) {
 		}
 	}
 
-	lis1, err := newListener(t, "origin-service-1", []string{"route-service-1"})
+	lis1, err := newListener(t, "origin-service-1")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
@@ -106,6 +128,41 @@ func TestE2E_ListSpecificListeners(t *testing.T) {
 		return
 	}
 
+	if err = strem.Send(&discovery.DiscoveryRequest{
+		TypeUrl: "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+		Node: &core.Node{
+			Id: "test-1",
+		},
+		ResourceNames: []string{"origin-service-1"},
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	rres, err := strem.Recv()
+	if err != nil {
+		t.Errorf("failed to receive a response: %s", err)
+		return
+	}
+
+	rgot := make([]*route.RouteConfiguration, len(rres.Resources))
+	for i, resource := range rres.Resources {
+		rgot[i] = new(route.RouteConfiguration)
+		if err = anypb.UnmarshalTo(resource, rgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	rwant := []*route.RouteConfiguration{
+		newRouteConfiguration(t, "origin-service-1", []string{"route-service-1"}),
+	}
+
+	if diff := cmp.Diff(rgot, rwant, protocmp.Transform()); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+
 	if err = strem.Send(&discovery.DiscoveryRequest{
 		TypeUrl: "type.googleapis.com/envoy.config.cluster.v3.Cluster",
 		Node: &core.Node{
@@ -181,13 +238,13 @@ func TestE2E_ListMultipleListerns(t *testing.T) {
 		}
 	}
 
-	l1, err := newListener(t, "origin-service-1", []string{"route-service-1"})
+	l1, err := newListener(t, "origin-service-1")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
 	}
 
-	l2, err := newListener(t, "origin-service-2", []string{"route-service-2", "route-service-3"})
+	l2, err := newListener(t, "origin-service-2")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
@@ -287,19 +344,31 @@ func TestE2E_ListAllResources(t *testing.T) {
 		}
 	}
 
-	l1, err := newListener(t, "origin-service-1", []string{"route-service-1"})
+	l1, err := newListener(t, "origin-service-1")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
+	}
+
+	l2, err := newListener(t, "origin-service-2")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
 	}
 
-	l2, err := newListener(t, "origin-service-2", []string{"route-service-2", "route-service-3"})
+	l3, err := newListener(t, "origin-service-without-route")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
 	}
 
-	l3, err := newListener(t, "origin-service-without-route", []string{})
+	l4, err := newAliasListener(t, "origin-service-without-route.internal", "origin-service-without-route")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
+	}
+
+	l5, err := newAliasListener(t, "origin-service-without-route:443", "origin-service-without-route")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
@@ -309,6 +378,8 @@ func TestE2E_ListAllResources(t *testing.T) {
 		l1,
 		l2,
 		l3,
+		l4,
+		l5,
 	}
 
 	if diff := cmp.Diff(lgot, lwant, protocmp.Transform(), cmpoptSortListeners); diff != "" {
@@ -364,6 +435,94 @@ func TestE2E_ListAllResources(t *testing.T) {
 	}
 }
 
+func TestE2E_ListAliasListener(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	strem, err := client.StreamAggregatedResources(ctx)
+	if err != nil {
+		t.Errorf("failed to create a stream: %s", err)
+		return
+	}
+
+	if err = strem.Send(&discovery.DiscoveryRequest{
+		TypeUrl: "type.googleapis.com/envoy.config.listener.v3.Listener",
+		Node: &core.Node{
+			Id: "test-alias-1",
+		},
+		ResourceNames: []string{"origin-service-without-route:443"},
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	lres, err := strem.Recv()
+	if err != nil {
+		t.Errorf("failed to receive a response: %s", err)
+		return
+	}
+
+	lgot := make([]*listener.Listener, len(lres.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range lres.Resources {
+		lgot[i] = new(listener.Listener)
+		if err = anypb.UnmarshalTo(resource, lgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	lis, err := newAliasListener(t, "origin-service-without-route:443", "origin-service-without-route")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
+	}
+
+	if diff := cmp.Diff(lgot, []*listener.Listener{lis}, protocmp.Transform()); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+
+	if err = strem.Send(&discovery.DiscoveryRequest{
+		TypeUrl: "type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+		Node: &core.Node{
+			Id: "test-alias-1",
+		},
+		ResourceNames: []string{"origin-service-without-route"},
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	rres, err := strem.Recv()
+	if err != nil {
+		t.Errorf("failed to receive a response: %s", err)
+		return
+	}
+
+	rgot := make([]*route.RouteConfiguration, len(rres.Resources))
+	for i, resource := range rres.Resources {
+		rgot[i] = new(route.RouteConfiguration)
+		if err = anypb.UnmarshalTo(resource, rgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	rc := newRouteConfiguration(t, "origin-service-without-route", nil)
+	rc.VirtualHosts[0].Domains = []string{
+		"origin-service-without-route",
+		"origin-service-without-route.internal",
+		"origin-service-without-route:443",
+	}
+
+	if diff := cmp.Diff(rgot, []*route.RouteConfiguration{rc}, protocmp.Transform()); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+}
+
 func TestE2E_ListMultipleClusters(t *testing.T) {
 	t.Parallel()
 
@@ -402,13 +561,13 @@ func TestE2E_ListMultipleClusters(t *testing.T) {
 		}
 	}
 
-	l1, err := newListener(t, "origin-service-1", []string{"route-service-1"})
+	l1, err := newListener(t, "origin-service-1")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
 	}
 
-	l2, err := newListener(t, "origin-service-2", []string{"route-service-2", "route-service-3"})
+	l2, err := newListener(t, "origin-service-2")
 	if err != nil {
 		t.Errorf("failed to create a listener: %s", err)
 		return
@@ -507,128 +666,814 @@ func TestE2E_ListMultipleClusters(t *testing.T) {
 	}
 }
 
-func newListener(t *testing.T, name string, routes []string) (*listener.Listener, error) {
-	t.Helper()
+func TestE2E_DeltaSpecificResources(t *testing.T) {
+	t.Parallel()
 
-	rs := make([]*route.Route, len(routes)+1)
+	ctx := context.Background()
 
-	for i, r := range routes {
-		rs[i] = newRoute(t, r, name)
+	strem, err := client.DeltaAggregatedResources(ctx)
+	if err != nil {
+		t.Errorf("failed to create a stream: %s", err)
+		return
 	}
 
-	rs[len(routes)] = newRoute(t, name, name)
-
-	hc := &hcm.HttpConnectionManager{
-		HttpFilters: []*hcm.HttpFilter{
-			{
-				Name: "envoy.filters.http.router",
-				ConfigType: &hcm.HttpFilter_TypedConfig{
-					TypedConfig: &anypb.Any{
-						TypeUrl: "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
-					},
-				},
-			},
-		},
-		RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{
-			RouteConfig: &route.RouteConfiguration{
-				VirtualHosts: []*route.VirtualHost{
-					{
-						Name:    name,
-						Domains: []string{name},
-						Routes:  rs,
-					},
-				},
-			},
+	if err = strem.Send(&discovery.DeltaDiscoveryRequest{
+		TypeUrl: "type.googleapis.com/envoy.config.listener.v3.Listener",
+		Node: &core.Node{
+			Id: "test-delta-1",
 		},
+		ResourceNamesSubscribe: []string{"origin-service-1"},
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
 	}
 
-	hcb, err := proto.Marshal(hc)
+	lres, err := strem.Recv()
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal hcb: %w", err)
+		t.Errorf("failed to receive a response: %s", err)
+		return
 	}
 
-	return &listener.Listener{
-		Name: name,
-		ApiListener: &listener.ApiListener{
-			ApiListener: &anypb.Any{
-				TypeUrl: "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
-				Value:   hcb,
-			},
-		},
-	}, nil
-}
-
-func newRoute(t *testing.T, name, originServiceName string) *route.Route {
-	t.Helper()
+	lgot := make([]*listener.Listener, len(lres.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range lres.Resources {
+		if resource.Version == "" {
+			t.Errorf("the version of the resource `%s` is empty", resource.Name)
+			return
+		}
 
-	var headers []*route.HeaderMatcher
-	if name != originServiceName {
-		headers = []*route.HeaderMatcher{
-			{
-				Name: fmt.Sprintf("cloud-run-service-router-%s", originServiceName),
-				HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{
-					ExactMatch: name,
-				},
-			},
+		lgot[i] = new(listener.Listener)
+		if err = anypb.UnmarshalTo(resource.Resource, lgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
 		}
 	}
 
-	action := &route.Route_Route{
-		Route: &route.RouteAction{
-			ClusterSpecifier: &route.RouteAction_Cluster{
-				Cluster: fmt.Sprintf("%s-test-an.a.run.app", name),
-			},
-			Timeout: &duration.Duration{Seconds: 10},
-		},
+	lis1, err := newListener(t, "origin-service-1")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
 	}
 
-	action.Route.HostRewriteSpecifier = &route.RouteAction_AutoHostRewrite{
-		AutoHostRewrite: &wrappers.BoolValue{
-			Value: true,
-		},
+	if diff := cmp.Diff(lgot, []*listener.Listener{lis1}, protocmp.Transform(), cmpoptSortListeners); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
 	}
 
-	return &route.Route{
-		Name: name,
-		Match: &route.RouteMatch{
-			PathSpecifier: &route.RouteMatch_Prefix{
-				Prefix: "/",
-			},
-			Headers: headers,
-		},
-		Action: action,
+	if err = strem.Send(&discovery.DeltaDiscoveryRequest{
+		TypeUrl:       "type.googleapis.com/envoy.config.listener.v3.Listener",
+		ResponseNonce: lres.Nonce,
+	}); err != nil {
+		t.Errorf("failed to send an ACK: %s", err)
+		return
+	}
+
+	// NOTE: the node is omitted since it is only required on the first request of the stream.
+	if err = strem.Send(&discovery.DeltaDiscoveryRequest{
+		TypeUrl:                "type.googleapis.com/envoy.config.cluster.v3.Cluster",
+		ResourceNamesSubscribe: []string{"origin-service-1-test-an.a.run.app", "route-service-1-test-an.a.run.app"},
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	cres, err := strem.Recv()
+	if err != nil {
+		t.Errorf("failed to receive a response: %s", err)
+		return
+	}
+
+	cgot := make([]*cluster.Cluster, len(cres.Resources))
+	for i, resource := range cres.Resources {
+		cgot[i] = new(cluster.Cluster)
+		if err = anypb.UnmarshalTo(resource.Resource, cgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	cwant := []*cluster.Cluster{
+		newCluster(t, "origin-service-1-test-an.a.run.app"),
+		newCluster(t, "route-service-1-test-an.a.run.app"),
+	}
+
+	if diff := cmp.Diff(cgot, cwant, protocmp.Transform(), cmpoptSortClusters); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
 	}
 }
 
-func newCluster(t *testing.T, name string) *cluster.Cluster {
-	t.Helper()
+func TestE2E_FetchResources(t *testing.T) {
+	t.Parallel()
 
-	return &cluster.Cluster{
-		Name: name,
-		ClusterDiscoveryType: &cluster.Cluster_Type{
-			Type: cluster.Cluster_LOGICAL_DNS,
+	ctx := context.Background()
+
+	lres, err := listenerClient.FetchListeners(ctx, &discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "test-fetch-1",
 		},
-		LbPolicy: cluster.Cluster_ROUND_ROBIN,
-		LoadAssignment: &endpoint.ClusterLoadAssignment{
-			ClusterName: name,
-			Endpoints: []*endpoint.LocalityLbEndpoints{
-				{
-					LbEndpoints: []*endpoint.LbEndpoint{
-						{
-							HostIdentifier: &endpoint.LbEndpoint_Endpoint{
-								Endpoint: &endpoint.Endpoint{
-									Hostname: name,
-									Address: &core.Address{
-										Address: &core.Address_SocketAddress{
-											SocketAddress: &core.SocketAddress{
-												Address: name,
-												PortSpecifier: &core.SocketAddress_PortValue{
-													PortValue: 443,
-												},
-											},
-										},
-									},
-								},
+		ResourceNames: []string{"origin-service-1"},
+	})
+	if err != nil {
+		t.Errorf("failed to fetch listeners: %s", err)
+		return
+	}
+
+	lgot := make([]*listener.Listener, len(lres.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range lres.Resources {
+		lgot[i] = new(listener.Listener)
+		if err = anypb.UnmarshalTo(resource, lgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	lis1, err := newListener(t, "origin-service-1")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
+	}
+
+	if diff := cmp.Diff(lgot, []*listener.Listener{lis1}, protocmp.Transform(), cmpoptSortListeners); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+
+	cres, err := clusterClient.FetchClusters(ctx, &discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "test-fetch-1",
+		},
+		ResourceNames: []string{"origin-service-1-test-an.a.run.app", "route-service-1-test-an.a.run.app"},
+	})
+	if err != nil {
+		t.Errorf("failed to fetch clusters: %s", err)
+		return
+	}
+
+	cgot := make([]*cluster.Cluster, len(cres.Resources))
+	for i, resource := range cres.Resources {
+		cgot[i] = new(cluster.Cluster)
+		if err = anypb.UnmarshalTo(resource, cgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	cwant := []*cluster.Cluster{
+		newCluster(t, "origin-service-1-test-an.a.run.app"),
+		newCluster(t, "route-service-1-test-an.a.run.app"),
+	}
+
+	if diff := cmp.Diff(cgot, cwant, protocmp.Transform(), cmpoptSortClusters); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+}
+
+func TestE2E_FetchClustersForProxylessClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	metadata, err := structpb.NewStruct(map[string]any{
+		"kauche.com/cloud-run-service-router-proxyless-security": true,
+	})
+	if err != nil {
+		t.Errorf("failed to create the node metadata: %s", err)
+		return
+	}
+
+	res, err := clusterClient.FetchClusters(ctx, &discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id:       "test-fetch-4",
+			Metadata: metadata,
+		},
+		ResourceNames: []string{"origin-service-2-test-an.a.run.app"},
+	})
+	if err != nil {
+		t.Errorf("failed to fetch clusters: %s", err)
+		return
+	}
+
+	got := make([]*cluster.Cluster, len(res.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range res.Resources {
+		got[i] = new(cluster.Cluster)
+		if err = anypb.UnmarshalTo(resource, got[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	want := newCluster(t, "origin-service-2-test-an.a.run.app")
+	want.TransportSocket = newTransportSocket(t, &tls.UpstreamTlsContext{
+		Sni: "origin-service-2-test-an.a.run.app",
+		CommonTlsContext: &tls.CommonTlsContext{
+			AlpnProtocols: []string{"h2", "http/1.1"},
+			ValidationContextType: &tls.CommonTlsContext_ValidationContext{
+				ValidationContext: &tls.CertificateValidationContext{
+					MatchTypedSubjectAltNames: newSubjectAltNameMatchers("origin-service-2-test-an.a.run.app"),
+					MatchSubjectAltNames: []*matcher.StringMatcher{
+						{
+							MatchPattern: &matcher.StringMatcher_Exact{
+								Exact: "origin-service-2-test-an.a.run.app",
+							},
+						},
+					},
+					CaCertificateProviderInstance: &tls.CertificateProviderPluginInstance{
+						InstanceName: "default",
+					},
+				},
+			},
+		},
+	})
+
+	if diff := cmp.Diff(got, []*cluster.Cluster{want}, protocmp.Transform()); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+}
+
+func TestE2E_FetchClusterLoadAssignments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	res, err := endpointClient.FetchEndpoints(ctx, &discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "test-fetch-3",
+		},
+		ResourceNames: []string{"origin-service-2-test-an.a.run.app"},
+	})
+	if err != nil {
+		t.Errorf("failed to fetch endpoints: %s", err)
+		return
+	}
+
+	got := make([]*endpoint.ClusterLoadAssignment, len(res.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range res.Resources {
+		got[i] = new(endpoint.ClusterLoadAssignment)
+		if err = anypb.UnmarshalTo(resource, got[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	want := []*endpoint.ClusterLoadAssignment{
+		{
+			ClusterName: "origin-service-2-test-an.a.run.app",
+			Endpoints: []*endpoint.LocalityLbEndpoints{
+				{
+					LbEndpoints: []*endpoint.LbEndpoint{
+						newLbEndpoint(t, "origin-service-2-test-an.a.run.app"),
+					},
+					LoadBalancingWeight: &wrappers.UInt32Value{
+						Value: 1,
+					},
+				},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+}
+
+func TestE2E_FetchListenersOverHTTP(t *testing.T) {
+	t.Parallel()
+
+	body, err := protojson.Marshal(&discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "test-fetch-2",
+		},
+		ResourceNames: []string{"origin-service-2"},
+	})
+	if err != nil {
+		t.Errorf("failed to marshal the request: %s", err)
+		return
+	}
+
+	// TODO: target
+	res, err := http.Post("http://localhost:11001/v3/discovery:listeners", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status code %d, got %d", http.StatusOK, res.StatusCode)
+		return
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("failed to read the response: %s", err)
+		return
+	}
+
+	dres := new(discovery.DiscoveryResponse)
+	if err = protojson.Unmarshal(b, dres); err != nil {
+		t.Errorf("failed to unmarshal the response: %s", err)
+		return
+	}
+
+	lgot := make([]*listener.Listener, len(dres.Resources))
+	unmarshalOptions := proto.UnmarshalOptions{}
+	for i, resource := range dres.Resources {
+		lgot[i] = new(listener.Listener)
+		if err = anypb.UnmarshalTo(resource, lgot[i], unmarshalOptions); err != nil {
+			t.Errorf("failed to unmarshal xds response: %s", err)
+			return
+		}
+	}
+
+	lis2, err := newListener(t, "origin-service-2")
+	if err != nil {
+		t.Errorf("failed to create a listener: %s", err)
+		return
+	}
+
+	if diff := cmp.Diff(lgot, []*listener.Listener{lis2}, protocmp.Transform(), cmpoptSortListeners); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+		return
+	}
+}
+
+func TestE2E_PostServiceChangeEvent(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		methodName string
+		want       int
+	}{
+		"should accept the event of updating a service": {
+			methodName: "google.cloud.run.v2.Services.UpdateService",
+			want:       http.StatusAccepted,
+		},
+		"should ignore the event of other methods": {
+			methodName: "google.cloud.run.v2.Jobs.RunJob",
+			want:       http.StatusNoContent,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// TODO: target
+			req, err := http.NewRequest(http.MethodPost, "http://localhost:11002/", strings.NewReader(`{}`))
+			if err != nil {
+				t.Errorf("failed to create a request: %s", err)
+				return
+			}
+
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("ce-specversion", "1.0")
+			req.Header.Set("ce-id", "test-event-1")
+			req.Header.Set("ce-type", "google.cloud.audit.log.v1.written")
+			req.Header.Set("ce-source", "//cloudaudit.googleapis.com/projects/test-project/logs/activity")
+			req.Header.Set("ce-methodname", test.methodName)
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("failed to send a request: %s", err)
+				return
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.want {
+				t.Errorf("want status code %d, got %d", test.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestE2E_GetServices(t *testing.T) {
+	t.Parallel()
+
+	// TODO: target
+	res, err := http.Get("http://localhost:11003/services")
+	if err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want status code %d, got %d", http.StatusOK, res.StatusCode)
+		return
+	}
+
+	var body struct {
+		RefreshedAt *string `json:"refreshedAt"`
+		Services    []struct {
+			Name   string `json:"name"`
+			Routes []struct {
+				Name string `json:"name"`
+			} `json:"routes"`
+		} `json:"services"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Errorf("failed to decode the response: %s", err)
+		return
+	}
+
+	if body.RefreshedAt == nil {
+		t.Error("want the time when services were refreshed, got null")
+	}
+
+	got := make(map[string][]string)
+	for _, s := range body.Services {
+		routes := []string{}
+		for _, r := range s.Routes {
+			routes = append(routes, r.Name)
+		}
+		got[s.Name] = routes
+	}
+
+	want := map[string][]string{
+		"origin-service-1":             {"route-service-1"},
+		"origin-service-2":             {"route-service-2", "route-service-3"},
+		"origin-service-without-route": {},
+	}
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+}
+
+func TestE2E_GetService(t *testing.T) {
+	t.Parallel()
+
+	for name, test := range map[string]struct {
+		service string
+		want    int
+	}{
+		"should return the service": {
+			service: "origin-service-1",
+			want:    http.StatusOK,
+		},
+		"should return not found if the service does not exist": {
+			service: "route-service-1",
+			want:    http.StatusNotFound,
+		},
+	} {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// TODO: target
+			res, err := http.Get("http://localhost:11003/services/" + test.service)
+			if err != nil {
+				t.Errorf("failed to send a request: %s", err)
+				return
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != test.want {
+				t.Errorf("want status code %d, got %d", test.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestE2E_GetClient(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	strem, err := client.StreamAggregatedResources(ctx)
+	if err != nil {
+		t.Errorf("failed to create a stream: %s", err)
+		return
+	}
+
+	req := &discovery.DiscoveryRequest{
+		TypeUrl: "type.googleapis.com/envoy.config.listener.v3.Listener",
+		Node: &core.Node{
+			Id:            "test-admin",
+			Cluster:       "staging",
+			UserAgentName: "envoy",
+			Locality: &core.Locality{
+				Region: "asia-northeast1",
+			},
+		},
+		ResourceNames: []string{"origin-service-1"},
+	}
+
+	if err = strem.Send(req); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	res, err := strem.Recv()
+	if err != nil {
+		t.Errorf("failed to receive a response: %s", err)
+		return
+	}
+
+	// NOTE: ACK the response.
+	if err = strem.Send(&discovery.DiscoveryRequest{
+		TypeUrl:       req.TypeUrl,
+		VersionInfo:   res.VersionInfo,
+		ResponseNonce: res.Nonce,
+		ResourceNames: req.ResourceNames,
+	}); err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+
+	var got struct {
+		ID        string `json:"id"`
+		Cluster   string `json:"cluster"`
+		UserAgent string `json:"userAgent"`
+		Locality  struct {
+			Region string `json:"region"`
+		} `json:"locality"`
+		Streams []struct {
+			Resources map[string]struct {
+				RequestedNames   []string `json:"requestedNames"`
+				LastSentVersion  string   `json:"lastSentVersion"`
+				LastAckedVersion string   `json:"lastAckedVersion"`
+			} `json:"resources"`
+		} `json:"streams"`
+	}
+
+	// NOTE: the ACK is processed asynchronously, so the client is polled until the version is ACKed.
+	for range 50 {
+		// TODO: target
+		hres, err := http.Get("http://localhost:11003/clients/test-admin")
+		if err != nil {
+			t.Errorf("failed to send a request: %s", err)
+			return
+		}
+
+		err = json.NewDecoder(hres.Body).Decode(&got)
+		hres.Body.Close()
+		if err != nil {
+			t.Errorf("failed to decode the response: %s", err)
+			return
+		}
+
+		if len(got.Streams) == 1 && got.Streams[0].Resources[req.TypeUrl].LastAckedVersion != "" {
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if got.Cluster != "staging" || got.UserAgent != "envoy" || got.Locality.Region != "asia-northeast1" {
+		t.Errorf("want the attributes of the node, got %+v", got)
+	}
+
+	if len(got.Streams) != 1 {
+		t.Errorf("want 1 stream, got %d", len(got.Streams))
+		return
+	}
+
+	rt := got.Streams[0].Resources[req.TypeUrl]
+	if diff := cmp.Diff(rt.RequestedNames, req.ResourceNames); diff != "" {
+		t.Errorf("\n(-got, +want)\n%s", diff)
+	}
+
+	if rt.LastSentVersion != res.VersionInfo || rt.LastAckedVersion != res.VersionInfo {
+		t.Errorf("want the sent and the ACKed version %s, got %s and %s", res.VersionInfo, rt.LastSentVersion, rt.LastAckedVersion)
+	}
+
+	// TODO: target
+	sres, err := http.Get("http://localhost:11003/clients/test-admin/snapshot")
+	if err != nil {
+		t.Errorf("failed to send a request: %s", err)
+		return
+	}
+	defer sres.Body.Close()
+
+	var snapshot map[string]struct {
+		Version   string                     `json:"version"`
+		Resources map[string]json.RawMessage `json:"resources"`
+	}
+
+	if err := json.NewDecoder(sres.Body).Decode(&snapshot); err != nil {
+		t.Errorf("failed to decode the response: %s", err)
+		return
+	}
+
+	listeners := snapshot[req.TypeUrl]
+	if listeners.Version != res.VersionInfo {
+		t.Errorf("want the version %s, got %s", res.VersionInfo, listeners.Version)
+	}
+
+	if _, ok := listeners.Resources["origin-service-1"]; !ok || len(listeners.Resources) != 1 {
+		t.Errorf("want the listener origin-service-1, got %v", listeners.Resources)
+	}
+}
+
+func newListener(t *testing.T, name string) (*listener.Listener, error) {
+	t.Helper()
+
+	return newAliasListener(t, name, name)
+}
+
+// newAliasListener returns the listener which refers to the RouteConfiguration of the origin service.
+func newAliasListener(t *testing.T, name string, originServiceName string) (*listener.Listener, error) {
+	t.Helper()
+
+	hc := &hcm.HttpConnectionManager{
+		HttpFilters: []*hcm.HttpFilter{
+			{
+				Name: "envoy.filters.http.router",
+				ConfigType: &hcm.HttpFilter_TypedConfig{
+					TypedConfig: &anypb.Any{
+						TypeUrl: "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router",
+					},
+				},
+			},
+		},
+		RouteSpecifier: &hcm.HttpConnectionManager_Rds{
+			Rds: &hcm.Rds{
+				ConfigSource: &core.ConfigSource{
+					ResourceApiVersion: core.ApiVersion_V3,
+					ConfigSourceSpecifier: &core.ConfigSource_Ads{
+						Ads: &core.AggregatedConfigSource{},
+					},
+				},
+				RouteConfigName: originServiceName,
+			},
+		},
+	}
+
+	hcb, err := proto.Marshal(hc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal hcb: %w", err)
+	}
+
+	return &listener.Listener{
+		Name: name,
+		ApiListener: &listener.ApiListener{
+			ApiListener: &anypb.Any{
+				TypeUrl: "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+				Value:   hcb,
+			},
+		},
+	}, nil
+}
+
+func newRouteConfiguration(t *testing.T, name string, routes []string) *route.RouteConfiguration {
+	t.Helper()
+
+	rs := make([]*route.Route, len(routes)+1)
+
+	for i, r := range routes {
+		rs[i] = newRoute(t, r, name)
+	}
+
+	rs[len(routes)] = newRoute(t, name, name)
+
+	return &route.RouteConfiguration{
+		Name: name,
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    name,
+				Domains: []string{name},
+				Routes:  rs,
+			},
+		},
+	}
+}
+
+func newRoute(t *testing.T, name, originServiceName string) *route.Route {
+	t.Helper()
+
+	var headers []*route.HeaderMatcher
+	if name != originServiceName {
+		headers = []*route.HeaderMatcher{
+			{
+				Name: fmt.Sprintf("cloud-run-service-router-%s", originServiceName),
+				HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{
+					ExactMatch: name,
+				},
+			},
+		}
+	}
+
+	action := &route.Route_Route{
+		Route: &route.RouteAction{
+			ClusterSpecifier: &route.RouteAction_Cluster{
+				Cluster: fmt.Sprintf("%s-test-an.a.run.app", name),
+			},
+			Timeout: &duration.Duration{Seconds: 10},
+			MaxStreamDuration: &route.RouteAction_MaxStreamDuration{
+				MaxStreamDuration: &duration.Duration{Seconds: 10},
+			},
+		},
+	}
+
+	action.Route.HostRewriteSpecifier = &route.RouteAction_AutoHostRewrite{
+		AutoHostRewrite: &wrappers.BoolValue{
+			Value: true,
+		},
+	}
+
+	return &route.Route{
+		Name: name,
+		Match: &route.RouteMatch{
+			PathSpecifier: &route.RouteMatch_Prefix{
+				Prefix: "/",
+			},
+			Headers: headers,
+		},
+		Action: action,
+	}
+}
+
+func newCluster(t *testing.T, name string) *cluster.Cluster {
+	t.Helper()
+
+	return &cluster.Cluster{
+		Name: name,
+		ClusterDiscoveryType: &cluster.Cluster_Type{
+			Type: cluster.Cluster_LOGICAL_DNS,
+		},
+		LbPolicy: cluster.Cluster_ROUND_ROBIN,
+		LoadAssignment: &endpoint.ClusterLoadAssignment{
+			ClusterName: name,
+			Endpoints: []*endpoint.LocalityLbEndpoints{
+				{
+					LbEndpoints: []*endpoint.LbEndpoint{
+						newLbEndpoint(t, name),
+					},
+				},
+			},
+		},
+		TypedExtensionProtocolOptions: map[string]*anypb.Any{
+			"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": newAny(t, &upstreamhttp.HttpProtocolOptions{
+				UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_AutoConfig{
+					AutoConfig: &upstreamhttp.HttpProtocolOptions_AutoHttpConfig{},
+				},
+			}),
+		},
+	}
+}
+
+func newSubjectAltNameMatchers(host string) []*tls.SubjectAltNameMatcher {
+	return []*tls.SubjectAltNameMatcher{
+		{
+			SanType: tls.SubjectAltNameMatcher_DNS,
+			Matcher: &matcher.StringMatcher{
+				MatchPattern: &matcher.StringMatcher_Exact{
+					Exact: host,
+				},
+			},
+		},
+	}
+}
+
+func newAny(t *testing.T, m proto.Message) *anypb.Any {
+	t.Helper()
+
+	a, err := anypb.New(m)
+	if err != nil {
+		t.Fatalf("failed to create an any protobuf: %s", err)
+	}
+
+	return a
+}
+
+func newTransportSocket(t *testing.T, ctx *tls.UpstreamTlsContext) *core.TransportSocket {
+	t.Helper()
+
+	a, err := anypb.New(ctx)
+	if err != nil {
+		t.Fatalf("failed to create an any protobuf: %s", err)
+	}
+
+	return &core.TransportSocket{
+		Name: "envoy.transport_sockets.tls",
+		ConfigType: &core.TransportSocket_TypedConfig{
+			TypedConfig: a,
+		},
+	}
+}
+
+func newLbEndpoint(t *testing.T, host string) *endpoint.LbEndpoint {
+	t.Helper()
+
+	return &endpoint.LbEndpoint{
+		HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+			Endpoint: &endpoint.Endpoint{
+				Hostname: host,
+				Address: &core.Address{
+					Address: &core.Address_SocketAddress{
+						SocketAddress: &core.SocketAddress{
+							Address: host,
+							PortSpecifier: &core.SocketAddress_PortValue{
+								PortValue: 443,
 							},
 						},
 					},
@@ -2,13 +2,22 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/distributor"
+	"github.com/kauche/cloud-run-service-router-xds/internal/domain/entity"
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/event"
 	"github.com/kauche/cloud-run-service-router-xds/internal/domain/repository"
+	"github.com/kauche/cloud-run-service-router-xds/internal/tracing"
 )
 
+var tracer = otel.Tracer("github.com/kauche/cloud-run-service-router-xds/internal/usecase")
+
 type ServiceUseCase struct {
 	broker      event.ServiceEventBroker
 	distributor distributor.ServiceDistributor
@@ -23,17 +32,72 @@ func NewServiceUseCase(broker event.ServiceEventBroker, distributor distributor.
 	}
 }
 
-func (u *ServiceUseCase) DistributeServices(ctx context.Context) error {
+// DistributeServices returns the result of the distribution along with the error, since the services are distributed to the other clients even if some clients fail.
+func (u *ServiceUseCase) DistributeServices(ctx context.Context) (*entity.DistributionResult, error) {
+	ctx, span := tracer.Start(ctx, "ServiceUseCase.DistributeServices")
+	defer span.End()
+
 	services, err := u.repository.ListAllServices(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to list services: %w", err)
+		return nil, tracing.RecordError(span, fmt.Errorf("failed to list services: %w", err))
 	}
 
-	if err := u.distributor.DistributeServices(ctx, services); err != nil {
-		return fmt.Errorf("failed to distribute services: %w", err)
+	span.SetAttributes(attribute.Int("services.count", len(services)))
+
+	result, err := u.distributor.DistributeServices(ctx, services)
+	if err != nil {
+		return result, tracing.RecordError(span, fmt.Errorf("failed to distribute services: %w", err))
 	}
 
-	return nil
+	return result, nil
+}
+
+// DistributeChangedServices returns the result of the distribution along with the error, since the services are distributed to the other clients even if some clients fail.
+func (u *ServiceUseCase) DistributeChangedServices(ctx context.Context, diff *entity.ServiceDiff) (*entity.DistributionResult, error) {
+	ctx, span := tracer.Start(ctx, "ServiceUseCase.DistributeChangedServices")
+	defer span.End()
+
+	services, err := u.repository.ListAllServices(ctx)
+	if err != nil {
+		return nil, tracing.RecordError(span, fmt.Errorf("failed to list services: %w", err))
+	}
+
+	span.SetAttributes(attribute.Int("services.count", len(services)))
+
+	result, err := u.distributor.DistributeChangedServices(ctx, services, diff)
+	if err != nil {
+		return result, tracing.RecordError(span, fmt.Errorf("failed to distribute changed services: %w", err))
+	}
+
+	return result, nil
+}
+
+func (u *ServiceUseCase) ListAllServices(ctx context.Context) ([]*entity.Service, error) {
+	services, err := u.repository.ListAllServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	return services, nil
+}
+
+// GetService returns the error which wraps repository.ErrServiceNotFound if the service with the name does not exist.
+func (u *ServiceUseCase) GetService(ctx context.Context, name string) (*entity.Service, error) {
+	service, err := u.repository.GetService(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the service `%s`: %w", name, err)
+	}
+
+	return service, nil
+}
+
+func (u *ServiceUseCase) LastRefreshedAt(ctx context.Context) (time.Time, error) {
+	t, err := u.repository.LastRefreshedAt(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the time when services were refreshed: %w", err)
+	}
+
+	return t, nil
 }
 
 func (u *ServiceUseCase) DistributeServicesToClient(ctx context.Context, client string, resources []string) error {
@@ -49,6 +113,19 @@ func (u *ServiceUseCase) DistributeServicesToClient(ctx context.Context, client
 	return nil
 }
 
+func (u *ServiceUseCase) DistributeRoutesToClient(ctx context.Context, client string, resources []string) error {
+	services, err := u.repository.ListAllServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	if err := u.distributor.DistributeRoutesToClient(ctx, services, client, resources); err != nil {
+		return fmt.Errorf("failed to distribute routes to the client `%s`: %w", client, err)
+	}
+
+	return nil
+}
+
 func (u *ServiceUseCase) DistributeClustersToClient(ctx context.Context, client string, resources []string) error {
 	services, err := u.repository.ListAllServices(ctx)
 	if err != nil {
@@ -62,18 +139,84 @@ func (u *ServiceUseCase) DistributeClustersToClient(ctx context.Context, client
 	return nil
 }
 
+func (u *ServiceUseCase) DistributeEndpointsToClient(ctx context.Context, client string, resources []string) error {
+	services, err := u.repository.ListAllServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	if err := u.distributor.DistributeEndpointsToClient(ctx, services, client, resources); err != nil {
+		return fmt.Errorf("failed to distribute endpoints to the client `%s`: %w", client, err)
+	}
+
+	return nil
+}
+
+// RefreshServices refreshes the services and publishes the difference.
+// If the services are refreshed only partially, the difference is still published and the error of the refresh is returned after that.
 func (u *ServiceUseCase) RefreshServices(ctx context.Context) error {
-	if err := u.repository.RefreshServices(ctx); err != nil {
-		return fmt.Errorf("failed to refresh services: %w", err)
+	ctx, span := tracer.Start(ctx, "ServiceUseCase.RefreshServices")
+	defer span.End()
+
+	diff, refreshErr := u.repository.RefreshServices(ctx)
+	if diff == nil {
+		return tracing.RecordError(span, fmt.Errorf("failed to refresh services: %w", refreshErr))
 	}
 
-	if err := u.broker.PublishServicesRefreshedEvent(ctx); err != nil {
+	span.SetAttributes(
+		attribute.Int("services.added", len(diff.Added)),
+		attribute.Int("services.removed", len(diff.Removed)),
+		attribute.Int("services.updated", len(diff.Updated)),
+	)
+
+	var errs []error
+	if refreshErr != nil {
+		errs = append(errs, fmt.Errorf("failed to refresh services partially: %w", refreshErr))
+	}
+
+	if err := u.publishRefreshedServices(ctx, diff); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return tracing.RecordError(span, err)
+	}
+
+	return nil
+}
+
+func (u *ServiceUseCase) publishRefreshedServices(ctx context.Context, diff *entity.ServiceDiff) error {
+	// NOTE: the services are not redistributed if nothing has changed, since snapshots of all clients are rebuilt on the distribution.
+	// Only the clients to which the last distribution failed are retried.
+	if diff.IsEmpty() {
+		return u.distributeServicesToFailedClients(ctx)
+	}
+
+	ev := &event.ServicesRefreshedEvent{
+		Diff:        diff,
+		RefreshedAt: time.Now(),
+	}
+
+	if err := u.broker.PublishServicesRefreshedEvent(ctx, ev); err != nil {
 		return fmt.Errorf("failed to publish serivce refreshed event: %w", err)
 	}
 
 	return nil
 }
 
+func (u *ServiceUseCase) distributeServicesToFailedClients(ctx context.Context) error {
+	services, err := u.repository.ListAllServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+
+	if _, err := u.distributor.DistributeServicesToFailedClients(ctx, services); err != nil {
+		return fmt.Errorf("failed to distribute services to the failed clients: %w", err)
+	}
+
+	return nil
+}
+
 func (u *ServiceUseCase) RegisterClientToDistributor(ctx context.Context, client string, serviceNames []string) error {
 	if err := u.distributor.RegisterClient(ctx, client, serviceNames); err != nil {
 		return fmt.Errorf("failed to add client to the distributor: %w", err)
@@ -82,6 +225,14 @@ func (u *ServiceUseCase) RegisterClientToDistributor(ctx context.Context, client
 	return nil
 }
 
+func (u *ServiceUseCase) RegisterRoutesToDistributor(ctx context.Context, client string, serviceNames []string) error {
+	if err := u.distributor.RegisterRoutesToClient(ctx, client, serviceNames); err != nil {
+		return fmt.Errorf("failed to register requested routes to the distributor: %w", err)
+	}
+
+	return nil
+}
+
 func (u *ServiceUseCase) RegisterClustersToDistributor(ctx context.Context, client string, serviceNames []string) error {
 	if err := u.distributor.RegisterClustersToClient(ctx, client, serviceNames); err != nil {
 		return fmt.Errorf("failed to register requested clusters to the distributor: %w", err)
@@ -89,3 +240,27 @@ func (u *ServiceUseCase) RegisterClustersToDistributor(ctx context.Context, clie
 
 	return nil
 }
+
+func (u *ServiceUseCase) RegisterEndpointsToDistributor(ctx context.Context, client string, clusterNames []string) error {
+	if err := u.distributor.RegisterEndpointsToClient(ctx, client, clusterNames); err != nil {
+		return fmt.Errorf("failed to register requested endpoints to the distributor: %w", err)
+	}
+
+	return nil
+}
+
+func (u *ServiceUseCase) RegisterClientAttributesToDistributor(ctx context.Context, client *entity.Client) error {
+	if err := u.distributor.RegisterClientAttributes(ctx, client); err != nil {
+		return fmt.Errorf("failed to register the attributes of the client `%s` to the distributor: %w", client.ID, err)
+	}
+
+	return nil
+}
+
+func (u *ServiceUseCase) UnregisterClientFromDistributor(ctx context.Context, client string) error {
+	if err := u.distributor.UnregisterClient(ctx, client); err != nil {
+		return fmt.Errorf("failed to unregister the client from the distributor: %w", err)
+	}
+
+	return nil
+}